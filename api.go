@@ -0,0 +1,277 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// maxAPIBodyBytes caps request bodies sent to the API.
+const maxAPIBodyBytes = 1 << 20
+
+// apiTicket is the API representation of an open or closed ticket.
+type apiTicket struct {
+	ID           string       `json:"id"` // Ticket channel or thread ID
+	GuildID      string       `json:"guild_id"`
+	UserID       string       `json:"user_id"`
+	UserName     string       `json:"user_name"`
+	Department   string       `json:"department"`
+	Status       TicketStatus `json:"status"`
+	ClaimedBy    string       `json:"claimed_by,omitempty"`
+	OpenedBy     string       `json:"opened_by,omitempty"`
+	OpenedAt     time.Time    `json:"opened_at"`
+	LastActivity time.Time    `json:"last_activity"`
+	ClosedAt     *time.Time   `json:"closed_at,omitempty"`
+	CloseReason  string       `json:"close_reason,omitempty"`
+}
+
+type apiMessage struct {
+	Time        time.Time `json:"time"`
+	AuthorID    string    `json:"author_id"`
+	Author      string    `json:"author"`
+	FromStaff   bool      `json:"from_staff"`
+	Content     string    `json:"content"`
+	Attachments []string  `json:"attachments,omitempty"`
+}
+
+func newAPITicket(t Ticket) apiTicket {
+	return apiTicket{
+		ID: t.ChannelID, GuildID: t.GuildID, UserID: t.UserID, UserName: t.UserName, Department: t.Department,
+		Status: t.Status, ClaimedBy: t.ClaimedBy, OpenedBy: t.OpenedBy, OpenedAt: t.OpenedAt, LastActivity: t.LastActivity,
+	}
+}
+
+func closedAPITicket(t transcript) apiTicket {
+	out := newAPITicket(t.Ticket)
+	out.Status = StatusClosed
+	out.ClosedAt = &t.ClosedAt
+	out.CloseReason = t.Reason
+	return out
+}
+
+func newAPIMessages(messages []transcriptMessage) []apiMessage {
+	out := make([]apiMessage, 0, len(messages))
+	for _, m := range messages {
+		out = append(out, apiMessage{Time: m.Time, AuthorID: m.AuthorID, Author: m.Author, FromStaff: m.FromStaff, Content: m.Content, Attachments: m.Attachments})
+	}
+	return out
+}
+
+// requireAPIToken wraps a handler with bearer token authentication. Without a configured
+// token the API is not served at all.
+func requireAPIToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := cfg.Secrets.APIToken.reveal()
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ModMail"`)
+			writeAPIError(w, http.StatusUnauthorized, "missing or invalid API token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// registerAPI adds the ticket REST API to the HTTP server:
+//
+//	GET  /api/tickets                  open tickets (?state=closed for closed ones)
+//	GET  /api/tickets/{id}             one ticket, open or closed
+//	GET  /api/tickets/{id}/transcript  the ticket's messages
+//	POST /api/tickets/{id}/reply       {"author_id": "...", "content": "..."}
+//	POST /api/tickets/{id}/close       {"author_id": "..."}
+//
+// Replies and closes act as the given staff member, who needs the same staff level as for
+// the equivalent Discord action.
+func registerAPI(s *discordgo.Session) {
+	if cfg.Secrets.APIToken == "" {
+		slog.Info("REST API disabled; set MODMAIL_API_TOKEN to enable it.")
+	}
+	http.HandleFunc("/api/tickets", requireAPIToken(handleAPITickets))
+	http.HandleFunc("/api/tickets/", requireAPIToken(func(w http.ResponseWriter, r *http.Request) {
+		handleAPITicket(s, w, r)
+	}))
+}
+
+func handleAPITickets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+
+	tickets := []apiTicket{}
+	if r.URL.Query().Get("state") == "closed" {
+		transcripts, err := loadTranscripts()
+		if err != nil {
+			slog.Error("Error loading transcripts for API", "err", err)
+			writeAPIError(w, http.StatusInternalServerError, "could not read transcripts")
+			return
+		}
+		for _, t := range transcripts {
+			tickets = append(tickets, closedAPITicket(t))
+		}
+	} else {
+		for _, t := range activeTickets.all() {
+			tickets = append(tickets, newAPITicket(*t))
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"tickets": tickets})
+}
+
+func handleAPITicket(s *discordgo.Session, w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/tickets/"), "/")
+	wantMethod := http.MethodPost
+	if action == "" || action == "transcript" {
+		wantMethod = http.MethodGet
+	}
+	if r.Method != wantMethod {
+		writeAPIError(w, http.StatusMethodNotAllowed, "use "+wantMethod)
+		return
+	}
+
+	open, isOpen := activeTickets.forChannel(id)
+	var closed transcript
+	if !isOpen {
+		var err error
+		if closed, err = loadTranscript(id); err != nil {
+			writeAPIError(w, http.StatusNotFound, "no ticket with that ID")
+			return
+		}
+	}
+
+	switch action {
+	case "":
+		if isOpen {
+			writeJSON(w, http.StatusOK, newAPITicket(*open))
+		} else {
+			writeJSON(w, http.StatusOK, closedAPITicket(closed))
+		}
+	case "transcript":
+		messages := closed.Messages
+		if isOpen {
+			messages = openTicketMessages(id)
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"messages": newAPIMessages(messages)})
+	case "reply", "close":
+		if !isOpen {
+			writeAPIError(w, http.StatusConflict, "ticket is already closed")
+			return
+		}
+		handleAPITicketAction(s, w, r, open, action)
+	default:
+		writeAPIError(w, http.StatusNotFound, "unknown action")
+	}
+}
+
+// handleAPITicketAction replies to or closes an open ticket on behalf of a staff member.
+func handleAPITicketAction(s *discordgo.Session, w http.ResponseWriter, r *http.Request, ticket *Ticket, action string) {
+	var body struct {
+		AuthorID string `json:"author_id"`
+		Content  string `json:"content"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBodyBytes)).Decode(&body); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	gc := cfg.guild(ticket.GuildID)
+	required := LevelHelper // Same as replying in the ticket channel
+	if action == "close" {
+		required = gc.commandLevel("close")
+	}
+	author, err := apiStaffMember(s, ticket, gc, body.AuthorID, required)
+	if err != nil {
+		writeAPIError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	switch action {
+	case "reply":
+		if strings.TrimSpace(body.Content) == "" {
+			writeAPIError(w, http.StatusBadRequest, "content must not be empty")
+			return
+		}
+		if err := sendStaffReply(s, ticket, author, body.Content, nil); err != nil {
+			writeAPIError(w, http.StatusBadGateway, "could not DM the user: "+err.Error())
+			return
+		}
+		mirrorAPIReply(s, ticket, author, body.Content)
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+
+	case "close":
+		mirrorAPIClose(s, ticket, author)
+		if err := closeTicket(s, ticket.ChannelID, author); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, errNoTicket) {
+				status = http.StatusConflict
+			}
+			writeAPIError(w, status, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+	}
+}
+
+// mirrorAPIReply shows a delivered API reply in the ticket channel, marked with the same ✅
+// that replies typed in Discord get, since staff there would not see it otherwise.
+func mirrorAPIReply(s *discordgo.Session, ticket *Ticket, author *discordgo.User, content string) {
+	logger := ticketLog(ticket).With("staff_id", author.ID)
+	msg, err := s.ChannelMessageSendEmbed(ticket.ChannelID, createMessageEmbed(author, content, "Staff Reply (via API)", 0xFF8C00)) // Dark Orange
+	if err != nil {
+		logger.Error("Error mirroring API reply into ticket", "err", err)
+		return
+	}
+	if err := s.MessageReactionAdd(ticket.ChannelID, msg.ID, "✅"); err != nil {
+		logger.Warn("Error reacting to mirrored API reply", "message_id", msg.ID, "err", err)
+	}
+}
+
+// mirrorAPIClose posts the notice /close shows in the ticket channel, naming the staff member
+// who closed the ticket through the API.
+func mirrorAPIClose(s *discordgo.Session, ticket *Ticket, author *discordgo.User) {
+	content := fmt.Sprintf("✅ Closing ticket (closed via API by %s)... Logging transcript and archiving channel (channel remains visible).", author.Mention())
+	_, err := s.ChannelMessageSendComplex(ticket.ChannelID, &discordgo.MessageSend{
+		Content:         content,
+		AllowedMentions: &discordgo.MessageAllowedMentions{}, // Name the author without pinging them
+	})
+	if err != nil {
+		ticketLog(ticket).Error("Error posting API close notice into ticket", "staff_id", author.ID, "err", err)
+	}
+}
+
+// apiStaffMember looks up the member an API request acts as and checks their staff level in
+// the ticket's guild. Only role-based levels count, since a fetched member carries no
+// computed permissions.
+func apiStaffMember(s *discordgo.Session, ticket *Ticket, gc *GuildConfig, authorID string, required StaffLevel) (*discordgo.User, error) {
+	if authorID == "" {
+		return nil, errors.New("author_id is required")
+	}
+	member, err := s.State.Member(ticket.GuildID, authorID)
+	if err != nil {
+		if member, err = s.GuildMember(ticket.GuildID, authorID); err != nil {
+			return nil, errors.New("author_id is not a member of the ticket's server")
+		}
+	}
+	var dept Department
+	if gc != nil {
+		dept = gc.department(ticket.Department)
+	}
+	if memberLevel(member, gc, dept) < required {
+		return nil, errors.New("author_id needs the " + required.String() + " staff level")
+	}
+	return member.User, nil
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Staff and admin actions recorded in the audit log.
+const (
+	auditContact      = "ticket.contact"
+	auditClaim        = "ticket.claim"
+	auditClose        = "ticket.close"
+	auditDelete       = "ticket.delete"
+	auditConfigChange = "config.change"
+	auditCreate       = "server.create" // Roles and channels the bot created
+)
+
+var auditActions = []string{auditContact, auditClaim, auditClose, auditDelete, auditConfigChange, auditCreate}
+
+const (
+	defaultAuditResults = 10
+	maxAuditResults     = 25
+)
+
+// auditEntry records who did what. Entries are appended to the audit file as JSON lines
+// and never rewritten.
+type auditEntry struct {
+	Time     time.Time
+	GuildID  string
+	Action   string
+	ActorID  string
+	Actor    string
+	TicketID string            `json:",omitempty"` // Ticket channel ID
+	TargetID string            `json:",omitempty"` // The ticket's user
+	Params   map[string]string `json:",omitempty"`
+}
+
+var auditFileMu sync.Mutex
+
+// auditFileName keeps the audit log next to the config file.
+func auditFileName() string {
+	return filepath.Join(filepath.Dir(configFileName), "audit.jsonl")
+}
+
+func auditActionChoices() []*discordgo.ApplicationCommandOptionChoice {
+	choices := make([]*discordgo.ApplicationCommandOptionChoice, 0, len(auditActions))
+	for _, action := range auditActions {
+		choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: action, Value: action})
+	}
+	return choices
+}
+
+// audit appends an entry to the audit log and posts a one-line summary to the log channel,
+// except for closed and deleted tickets, whose transcript log embed already records them.
+func audit(s *discordgo.Session, entry auditEntry) {
+	entry.Time = time.Now().UTC()
+	line, err := json.Marshal(entry)
+	if err != nil {
+		slog.Error("Error marshalling audit entry", "action", entry.Action, "err", err)
+		return
+	}
+
+	auditFileMu.Lock()
+	f, err := os.OpenFile(auditFileName(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err == nil {
+		_, err = f.Write(append(line, '\n'))
+		f.Close()
+	}
+	auditFileMu.Unlock()
+	if err != nil {
+		slog.Error("Error writing audit log", "file", auditFileName(), "err", err)
+	}
+
+	if entry.Action == auditClose || entry.Action == auditDelete {
+		return
+	}
+	gc := cfg.guild(entry.GuildID)
+	if gc == nil {
+		return
+	}
+	logChannelID := gc.department(entry.Params["department"]).LogChannelID
+	if logChannelID == "" {
+		return
+	}
+	sendEmbed(s, slog.With("guild_id", entry.GuildID, "ticket_id", entry.TicketID, "user_id", entry.TargetID), logChannelID, &discordgo.MessageEmbed{
+		Description: "📋 " + entry.summary(),
+		Color:       0x99AAB5, // Greyple
+		Timestamp:   entry.Time.Format(time.RFC3339),
+	})
+}
+
+// auditCreated records roles and channels the bot created for actor. ids maps each kind of
+// resource (e.g. "category") to its ID; created lists them for the log channel summary.
+func auditCreated(s *discordgo.Session, guildID string, actor *discordgo.User, source string, created []string, ids map[string]string, overwrites []*discordgo.PermissionOverwrite) {
+	params := map[string]string{"source": source, "created": strings.Join(created, ", ")}
+	for kind, id := range ids {
+		params[kind+"_id"] = id
+	}
+	if len(overwrites) > 0 {
+		params["overwrites"] = formatOverwrites(overwrites)
+	}
+	audit(s, auditEntry{GuildID: guildID, Action: auditCreate, ActorID: actor.ID, Actor: actor.String(), Params: params})
+}
+
+// formatOverwrites renders permission overwrites as "role|member ID +allow -deny" with the
+// permission bitfields in decimal, as Discord's API shows them.
+func formatOverwrites(overwrites []*discordgo.PermissionOverwrite) string {
+	parts := make([]string, 0, len(overwrites))
+	for _, o := range overwrites {
+		kind := "role"
+		if o.Type == discordgo.PermissionOverwriteTypeMember {
+			kind = "member"
+		}
+		parts = append(parts, fmt.Sprintf("%s %s +%d -%d", kind, o.ID, o.Allow, o.Deny))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// botActor is the actor recorded for changes the bot makes on its own.
+func botActor(s *discordgo.Session) *discordgo.User {
+	if s != nil && s.State != nil && s.State.User != nil {
+		return s.State.User
+	}
+	return &discordgo.User{Username: "ModMail"}
+}
+
+// summary renders an entry as one line of Discord markdown.
+func (e auditEntry) summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**%s** by <@%s>", e.Action, e.ActorID)
+	if e.TicketID != "" {
+		fmt.Fprintf(&b, " · ticket <#%s>", e.TicketID)
+	}
+	if e.TargetID != "" {
+		fmt.Fprintf(&b, " · user <@%s>", e.TargetID)
+	}
+	for _, key := range []string{"department", "reason", "source", "revision", "changes", "created"} {
+		if value := e.Params[key]; value != "" {
+			fmt.Fprintf(&b, " · %s: %s", key, truncate(value, 200))
+		}
+	}
+	return b.String()
+}
+
+// auditTicketEvent records ticket actions taken by staff. Tickets users open themselves
+// are not staff actions and are left out.
+func auditTicketEvent(s *discordgo.Session, e TicketEvent) {
+	var entry auditEntry
+	var actor *discordgo.User
+	switch e := e.(type) {
+	case TicketOpened:
+		if e.OpenedBy == nil {
+			return
+		}
+		entry.Action, actor = auditContact, e.OpenedBy
+	case TicketClaimed:
+		entry.Action, actor = auditClaim, e.By
+	case TicketClosed:
+		entry.Action, actor = auditClose, e.By
+		if e.Deleted {
+			entry.Action = auditDelete
+		}
+		entry.Params = map[string]string{"reason": e.Reason}
+	default:
+		return
+	}
+
+	ticket := e.ticket()
+	entry.GuildID, entry.TicketID, entry.TargetID = ticket.GuildID, ticket.ChannelID, ticket.UserID
+	entry.ActorID, entry.Actor = actor.ID, actor.String()
+	if ticket.Department != "" {
+		if entry.Params == nil {
+			entry.Params = map[string]string{}
+		}
+		entry.Params["department"] = ticket.Department
+	}
+	audit(s, entry)
+}
+
+// readAuditLog returns the guild's audit entries matching the filters, newest first.
+// Empty filters match everything; userID matches the actor or the target user.
+func readAuditLog(guildID, action, userID string, limit int) ([]auditEntry, error) {
+	auditFileMu.Lock()
+	defer auditFileMu.Unlock()
+	f, err := os.Open(auditFileName())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var matched []auditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			slog.Warn("Skipping malformed audit entry", "file", auditFileName(), "err", err)
+			continue
+		}
+		if entry.GuildID != guildID || (action != "" && entry.Action != action) ||
+			(userID != "" && entry.ActorID != userID && entry.TargetID != userID) {
+			continue
+		}
+		matched = append(matched, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]auditEntry, 0, limit)
+	for n := len(matched) - 1; n >= 0 && len(out) < limit; n-- {
+		out = append(out, matched[n])
+	}
+	return out, nil
+}
+
+// handleAuditCommand lists recent audit entries, optionally filtered by action and user.
+func handleAuditCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var action, userID string
+	limit := defaultAuditResults
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "action":
+			action = option.StringValue()
+		case "user":
+			userID = option.UserValue(nil).ID
+		case "limit":
+			limit = int(option.IntValue())
+		}
+	}
+
+	entries, err := readAuditLog(i.GuildID, action, userID, limit)
+	if err != nil {
+		interactionLog(i).Error("Error reading audit log", "err", err)
+		respondEphemeral(s, i, "❌ The audit log could not be read.")
+		return
+	}
+	if len(entries) == 0 {
+		respondEphemeral(s, i, "No matching staff actions have been recorded in this server.")
+		return
+	}
+
+	var b strings.Builder
+	for _, entry := range entries {
+		fmt.Fprintf(&b, "<t:%d:f> %s\n", entry.Time.Unix(), entry.summary())
+	}
+	respond(s, i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{{
+				Title:       "📋 Audit Log",
+				Description: truncate(b.String(), 4096),
+				Footer:      &discordgo.MessageEmbedFooter{Text: fmt.Sprintf("%d most recent matching entries", len(entries))},
+				Color:       0x99AAB5, // Greyple
+			}},
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
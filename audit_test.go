@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// withAuditFile points the audit log at an empty file in a temporary directory.
+func withAuditFile(t *testing.T) string {
+	saved := configFileName
+	configFileName = filepath.Join(t.TempDir(), "config.json")
+	t.Cleanup(func() { configFileName = saved })
+	return auditFileName()
+}
+
+func TestReadAuditLog(t *testing.T) {
+	path := withAuditFile(t)
+	entries := []auditEntry{
+		{GuildID: "g1", Action: auditContact, ActorID: "staff1", TargetID: "user1", TicketID: "t1"},
+		{GuildID: "g2", Action: auditClaim, ActorID: "staff1", TargetID: "user1", TicketID: "t2"},
+		{GuildID: "g1", Action: auditClaim, ActorID: "staff2", TargetID: "user1", TicketID: "t1"},
+		{GuildID: "g1", Action: auditConfigChange, ActorID: "admin", Params: map[string]string{"LogChannelID": "old → new"}},
+		{GuildID: "g1", Action: auditClaim, ActorID: "staff1", TargetID: "user2", TicketID: "t3"},
+	}
+	for _, e := range entries[:2] {
+		audit(nil, e)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("{not json\n")
+	f.Close()
+	for _, e := range entries[2:] {
+		audit(nil, e)
+	}
+
+	tests := []struct {
+		name, guildID, action, userID string
+		limit                         int
+		want                          []string // Ticket IDs, or actors for entries without one
+	}{
+		{"guild only", "g1", "", "", 10, []string{"t3", "admin", "t1", "t1"}},
+		{"other guild", "g2", "", "", 10, []string{"t2"}},
+		{"unknown guild", "g3", "", "", 10, nil},
+		{"action", "g1", auditClaim, "", 10, []string{"t3", "t1"}},
+		{"actor", "g1", "", "staff1", 10, []string{"t3", "t1"}},
+		{"target", "g1", "", "user1", 10, []string{"t1", "t1"}},
+		{"action and user", "g1", auditClaim, "user1", 10, []string{"t1"}},
+		{"limit keeps newest", "g1", "", "", 2, []string{"t3", "admin"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readAuditLog(tt.guildID, tt.action, tt.userID, tt.limit)
+			if err != nil {
+				t.Fatalf("readAuditLog: %v", err)
+			}
+			var ids []string
+			for _, e := range got {
+				id := e.TicketID
+				if id == "" {
+					id = e.ActorID
+				}
+				ids = append(ids, id)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("got %v, want %v", ids, tt.want)
+			}
+		})
+	}
+
+	got, _ := readAuditLog("g1", auditConfigChange, "", 1)
+	if len(got) != 1 || got[0].Params["LogChannelID"] != "old → new" || got[0].Time.IsZero() {
+		t.Errorf("config change entry did not round-trip: %+v", got)
+	}
+}
+
+func TestReadAuditLogMissingFile(t *testing.T) {
+	withAuditFile(t)
+	got, err := readAuditLog("g1", "", "", 10)
+	if err != nil || len(got) != 0 {
+		t.Errorf("readAuditLog on a missing file = %v, %v; want no entries and no error", got, err)
+	}
+}
+
+// fakeDiscord serves the REST calls that create roles and channels, numbering the IDs it
+// hands out, and points discordgo at it for the duration of a test.
+func fakeDiscord(t *testing.T) *discordgo.Session {
+	var next atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		body["id"] = strconv.FormatInt(900+next.Add(1), 10)
+		json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(srv.Close)
+
+	savedGuilds, savedChannels := discordgo.EndpointGuilds, discordgo.EndpointChannels
+	discordgo.EndpointGuilds = srv.URL + "/guilds/"
+	discordgo.EndpointChannels = srv.URL + "/channels/"
+	t.Cleanup(func() { discordgo.EndpointGuilds, discordgo.EndpointChannels = savedGuilds, savedChannels })
+
+	s, err := discordgo.New("Bot test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.State.User = &discordgo.User{ID: "42", Username: "ModMail"}
+	return s
+}
+
+func TestSetupWizardAudited(t *testing.T) {
+	withAuditFile(t)
+	s := fakeDiscord(t)
+	staff := &discordgo.User{ID: "7", Username: "admin"}
+
+	createMissingResources(s, "g1", staff, &setupWizard{})
+
+	entries, err := readAuditLog("g1", auditCreate, "", 10)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("readAuditLog = %v, %v; want one entry", entries, err)
+	}
+	e := entries[0]
+	if e.ActorID != "7" {
+		t.Errorf("ActorID = %q, want the staff member who ran the wizard", e.ActorID)
+	}
+	want := map[string]string{"staff_role_id": "901", "category_id": "902", "log_channel_id": "903"}
+	for key, id := range want {
+		if e.Params[key] != id {
+			t.Errorf("Params[%s] = %q, want %q", key, e.Params[key], id)
+		}
+	}
+	if !strings.Contains(e.Params["overwrites"], "role g1 +0 -1024") || !strings.Contains(e.Params["overwrites"], "role 901 +") {
+		t.Errorf("Params[overwrites] = %q, want @everyone hidden and the staff role allowed", e.Params["overwrites"])
+	}
+}
+
+func TestOverflowCategoryAudited(t *testing.T) {
+	withConfigFile(t)
+	s := fakeDiscord(t)
+	cfg.setGuild("g1", &GuildConfig{ModMailCategoryID: "c1", AutoCreateOverflow: true})
+	guild := &discordgo.Guild{ID: "g1"}
+	for i := 0; i < maxCategoryChannels; i++ {
+		guild.Channels = append(guild.Channels, &discordgo.Channel{ID: strconv.Itoa(i), GuildID: "g1", ParentID: "c1"})
+	}
+	if err := s.State.GuildAdd(guild); err != nil {
+		t.Fatal(err)
+	}
+
+	categoryID, err := pickTicketCategory(s, "g1", cfg.guild("g1").department(""), map[string]bool{})
+	if err != nil {
+		t.Fatalf("pickTicketCategory: %v", err)
+	}
+
+	created, _ := readAuditLog("g1", auditCreate, "", 10)
+	if len(created) != 1 || created[0].Params["category_id"] != categoryID || created[0].ActorID != "42" {
+		t.Errorf("server.create entries = %+v, want one for category %s by the bot", created, categoryID)
+	}
+	changes, _ := readAuditLog("g1", auditConfigChange, "", 10)
+	if len(changes) != 1 || !strings.Contains(changes[0].Params["changes"], categoryID) || changes[0].ActorID != "42" {
+		t.Errorf("config.change entries = %+v, want one recording the new overflow category", changes)
+	}
+}
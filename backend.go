@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Ticket modes selectable per guild in config.json.
+const (
+	TicketModeChannel = "channel" // A text channel per ticket in the ModMail category (default)
+	TicketModeForum   = "forum"   // A post per ticket in a forum channel, tagged by status
+	TicketModeThread  = "thread"  // A private thread per ticket in a text channel
+)
+
+// Threads stay open for a week without activity before Discord auto-archives them.
+const ticketThreadArchiveMinutes = 10080
+
+// ticketBackend creates the place where staff handle a ticket and reflects status changes on it.
+type ticketBackend interface {
+	// open creates the ticket channel or thread, posts the intro embed and returns its ID.
+	open(s *discordgo.Session, guildID, name string, user *discordgo.User, dept Department, intro *discordgo.MessageEmbed) (string, error)
+	// setStatus updates the ticket's channel or thread after a claim or close.
+	setStatus(s *discordgo.Session, t *Ticket, status TicketStatus) error
+}
+
+// backendFor returns the ticket backend selected by the guild's TicketMode.
+func backendFor(gc *GuildConfig) ticketBackend {
+	switch gc.TicketMode {
+	case TicketModeForum:
+		return forumBackend{gc: gc}
+	case TicketModeThread:
+		return threadBackend{gc: gc}
+	default:
+		return channelBackend{gc: gc}
+	}
+}
+
+// isTicketChannel reports whether the channel belongs to the guild's ticket backend: a text
+// channel in a ticket category, or a thread under the configured ticket parent channel.
+func (gc *GuildConfig) isTicketChannel(ch *discordgo.Channel) bool {
+	if gc == nil || ch == nil {
+		return false
+	}
+	if ch.IsThread() {
+		for _, id := range gc.threadParentIDs() {
+			if ch.ParentID == id {
+				return true
+			}
+		}
+		return false
+	}
+	return ch.Type == discordgo.ChannelTypeGuildText && gc.isTicketCategory(ch.ParentID)
+}
+
+// channelBackend creates a private text channel per ticket inside the department's category.
+type channelBackend struct{ gc *GuildConfig }
+
+func (b channelBackend) open(s *discordgo.Session, guildID, name string, user *discordgo.User, dept Department, intro *discordgo.MessageEmbed) (string, error) {
+	if dept.CategoryID == "" {
+		return "", fmt.Errorf("no ticket category configured for department %q", dept.Name)
+	}
+
+	permissionOverwrites := []*discordgo.PermissionOverwrite{
+		{
+			ID:   guildID, // @everyone role
+			Type: discordgo.PermissionOverwriteTypeRole,
+			Deny: discordgo.PermissionViewChannel,
+		},
+	}
+	for _, roleID := range ticketStaffRoles(b.gc, dept) {
+		permissionOverwrites = append(permissionOverwrites, &discordgo.PermissionOverwrite{
+			ID:   roleID,
+			Type: discordgo.PermissionOverwriteTypeRole,
+			Allow: discordgo.PermissionViewChannel |
+				discordgo.PermissionSendMessages |
+				discordgo.PermissionReadMessageHistory,
+		})
+	}
+
+	// The cached channel counts can be stale or raced by another ticket, so a category
+	// Discord reports as full is skipped and the next one tried.
+	full := make(map[string]bool)
+	for {
+		categoryID, err := pickTicketCategory(s, guildID, dept, full)
+		if err != nil {
+			return "", err
+		}
+
+		ch, err := s.GuildChannelCreateComplex(guildID, discordgo.GuildChannelCreateData{
+			Name:                 name,
+			Type:                 discordgo.ChannelTypeGuildText,
+			ParentID:             categoryID,
+			Topic:                fmt.Sprintf("ModMail ticket for %s (%s)", user.String(), user.ID),
+			PermissionOverwrites: permissionOverwrites,
+		})
+		if isCategoryFull(err) && !full[categoryID] {
+			slog.Warn("Ticket category is full, trying the next one", "guild_id", guildID, "category_id", categoryID)
+			full[categoryID] = true
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		sendEmbed(s, slog.With("guild_id", guildID, "user_id", user.ID), ch.ID, intro)
+		return ch.ID, nil
+	}
+}
+
+// Ticket channels stay in place when closed, so there is nothing to update.
+func (b channelBackend) setStatus(s *discordgo.Session, t *Ticket, status TicketStatus) error {
+	return nil
+}
+
+// forumBackend creates a post per ticket in the department's forum channel. Visibility comes
+// from the forum's own permissions, and the post's tags track the ticket status.
+type forumBackend struct{ gc *GuildConfig }
+
+func (b forumBackend) open(s *discordgo.Session, guildID, name string, user *discordgo.User, dept Department, intro *discordgo.MessageEmbed) (string, error) {
+	if dept.ThreadParentID == "" {
+		return "", fmt.Errorf("no forum channel configured for department %q", dept.Name)
+	}
+
+	var tags []string
+	if tagID := dept.ForumTagIDs[StatusOpen]; tagID != "" {
+		tags = append(tags, tagID)
+	}
+	thread, err := s.ForumThreadStartComplex(dept.ThreadParentID, &discordgo.ThreadStart{
+		Name:                name,
+		AutoArchiveDuration: ticketThreadArchiveMinutes,
+		AppliedTags:         tags,
+	}, &discordgo.MessageSend{
+		Content: fmt.Sprintf("ModMail ticket for %s (%s)", user.String(), user.ID),
+		Embeds:  []*discordgo.MessageEmbed{intro},
+	})
+	if err != nil {
+		return "", err
+	}
+	return thread.ID, nil
+}
+
+// setStatus swaps the post's status tag, keeping any tags staff added by hand, and
+// archives and locks the post once the ticket is closed.
+func (b forumBackend) setStatus(s *discordgo.Session, t *Ticket, status TicketStatus) error {
+	var current []string
+	if thread, err := s.State.Channel(t.ChannelID); err == nil {
+		current = thread.AppliedTags
+	} else if thread, err := s.Channel(t.ChannelID); err == nil {
+		current = thread.AppliedTags
+	} else {
+		ticketLog(t).Warn("Error fetching forum post; tags staff added by hand will be dropped", "err", err)
+	}
+
+	tagIDs := b.gc.department(t.Department).ForumTagIDs
+	statusTags := make(map[string]bool)
+	for _, tagID := range tagIDs {
+		statusTags[tagID] = true
+	}
+	tags := []string{}
+	for _, tagID := range current {
+		if !statusTags[tagID] {
+			tags = append(tags, tagID)
+		}
+	}
+	if tagID := tagIDs[status]; tagID != "" {
+		tags = append(tags, tagID)
+	}
+
+	edit := &discordgo.ChannelEdit{AppliedTags: &tags}
+	if status == StatusClosed {
+		archived, locked := true, true
+		edit.Archived = &archived
+		edit.Locked = &locked
+	}
+	_, err := s.ChannelEditComplex(t.ChannelID, edit)
+	return err
+}
+
+// threadBackend creates a private thread per ticket in the department's text channel. Staff
+// need the Manage Threads permission on that channel to see threads they were not added to.
+type threadBackend struct{ gc *GuildConfig }
+
+func (b threadBackend) open(s *discordgo.Session, guildID, name string, user *discordgo.User, dept Department, intro *discordgo.MessageEmbed) (string, error) {
+	if dept.ThreadParentID == "" {
+		return "", fmt.Errorf("no parent channel configured for department %q", dept.Name)
+	}
+
+	thread, err := s.ThreadStartComplex(dept.ThreadParentID, &discordgo.ThreadStart{
+		Name:                name,
+		AutoArchiveDuration: ticketThreadArchiveMinutes,
+		Type:                discordgo.ChannelTypeGuildPrivateThread,
+		Invitable:           false,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sendEmbed(s, slog.With("guild_id", guildID, "user_id", user.ID), thread.ID, intro)
+	return thread.ID, nil
+}
+
+// Private threads have no tags, so only closing changes anything: the thread is archived and locked.
+func (b threadBackend) setStatus(s *discordgo.Session, t *Ticket, status TicketStatus) error {
+	if status != StatusClosed {
+		return nil
+	}
+	archived, locked := true, true
+	_, err := s.ChannelEditComplex(t.ChannelID, &discordgo.ChannelEdit{
+		Archived: &archived,
+		Locked:   &locked,
+	})
+	return err
+}
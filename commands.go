@@ -1,33 +1,62 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"strings"
 
 	"github.com/bwmarrin/discordgo"
 )
 
+// Default permissions decide who sees a command in the picker until a server admin overrides
+// them under Server Settings > Integrations. They only control visibility; the staff levels in
+// permissions.go are still checked when a command runs.
+var (
+	adminCommandPermissions int64 = discordgo.PermissionManageServer
+	staffCommandPermissions int64 = discordgo.PermissionManageMessages
+	guildOnly                     = false
+	minRevision                   = 1.0 // Smallest revision /modmail-config rollback accepts
+	minAuditResults               = 1.0
+)
+
 var commands = []*discordgo.ApplicationCommand{
 	{
-		Name:        "modmail-setup",
-		Description: "Verify the current ModMail setup (Admin only)",
+		Name:                     "modmail-setup",
+		Description:              "Check or configure the ModMail setup (Admin only)",
+		DefaultMemberPermissions: &adminCommandPermissions,
+		DMPermission:             &guildOnly,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "check",
+				Description: "Check the ModMail setup for problems",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "wizard",
+				Description: "Pick or create the category, log channel and staff role step by step",
+			},
+		},
 	},
 	{
-		Name:        "modmail-set-config", 
-		Description: "Set core configuration (Category, Log Channel, Staff Role)",
+		Name:                     "modmail-set-config",
+		Description:              "Set core configuration (Category, Log Channel, Staff Role)",
+		DefaultMemberPermissions: &adminCommandPermissions,
+		DMPermission:             &guildOnly,
 		Options: []*discordgo.ApplicationCommandOption{
 			{
-				Type:        discordgo.ApplicationCommandOptionChannel,
-				Name:        "category",
-				Description: "The CATEGORY where new tickets will be created.",
-				Required:    true,
+				Type:         discordgo.ApplicationCommandOptionChannel,
+				Name:         "category",
+				Description:  "The CATEGORY where new tickets will be created.",
+				Required:     true,
 				ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildCategory},
 			},
 			{
-				Type:        discordgo.ApplicationCommandOptionChannel,
-				Name:        "log-channel",
-				Description: "The TEXT CHANNEL for logging transcripts and closures.",
-				Required:    true,
+				Type:         discordgo.ApplicationCommandOptionChannel,
+				Name:         "log-channel",
+				Description:  "The TEXT CHANNEL for logging transcripts and closures.",
+				Required:     true,
 				ChannelTypes: []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
 			},
 			{
@@ -39,77 +68,330 @@ var commands = []*discordgo.ApplicationCommand{
 		},
 	},
 	{
-		Name:        "claim",
-		Description: "Claim a ModMail ticket",
+		Name:                     "modmail-config",
+		Description:              "View or change individual ModMail settings (Admin only)",
+		DefaultMemberPermissions: &adminCommandPermissions,
+		DMPermission:             &guildOnly,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "get",
+				Description: "Show one setting, or all settings if no key is given",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "key",
+						Description:  "The setting to show.",
+						Autocomplete: true,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "set",
+				Description: "Change a setting",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "key",
+						Description:  "The setting to change.",
+						Required:     true,
+						Autocomplete: true,
+					},
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "value",
+						Description:  "The new value (IDs or mentions for channels and roles, comma-separated for lists).",
+						Required:     true,
+						Autocomplete: true,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "history",
+				Description: "Show recent configuration changes",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "rollback",
+				Description: "Restore the settings from an earlier revision",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:        discordgo.ApplicationCommandOptionInteger,
+						Name:        "revision",
+						Description: "The revision number from /modmail-config history.",
+						Required:    true,
+						MinValue:    &minRevision,
+					},
+				},
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionSubCommand,
+				Name:        "reset",
+				Description: "Clear a setting back to its default",
+				Options: []*discordgo.ApplicationCommandOption{
+					{
+						Type:         discordgo.ApplicationCommandOptionString,
+						Name:         "key",
+						Description:  "The setting to reset.",
+						Required:     true,
+						Autocomplete: true,
+					},
+				},
+			},
+		},
 	},
 	{
-		Name:        "close",
-		Description: "Close the current ModMail ticket (preserves channel)",
+		Name:                     "modmail-commands",
+		Description:              "Show which roles can see each ModMail command (Admin only)",
+		DefaultMemberPermissions: &adminCommandPermissions,
+		DMPermission:             &guildOnly,
 	},
 	{
-		Name:        "delete",
-		Description: "Close and permanently delete the current ModMail ticket",
+		Name:                     "modmail-webhooks",
+		Description:              "Show outgoing webhooks and their recent deliveries (Admin only)",
+		DefaultMemberPermissions: &adminCommandPermissions,
+		DMPermission:             &guildOnly,
+	},
+	{
+		Name:                     "audit",
+		Description:              "Show recent staff and admin actions (Admin only)",
+		DefaultMemberPermissions: &adminCommandPermissions,
+		DMPermission:             &guildOnly,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "action",
+				Description: "Only show this kind of action.",
+				Choices:     auditActionChoices(),
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionUser,
+				Name:        "user",
+				Description: "Only show actions by or on this user.",
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionInteger,
+				Name:        "limit",
+				Description: "How many entries to show (default 10).",
+				MinValue:    &minAuditResults,
+				MaxValue:    maxAuditResults,
+			},
+		},
+	},
+	{
+		Name:                     "contact",
+		Description:              "Open a ModMail ticket with a user and send them a message",
+		DefaultMemberPermissions: &staffCommandPermissions,
+		DMPermission:             &guildOnly,
+		Options: []*discordgo.ApplicationCommandOption{
+			{
+				Type:        discordgo.ApplicationCommandOptionUser,
+				Name:        "user",
+				Description: "The user to contact.",
+				Required:    true,
+			},
+			{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "message",
+				Description: "The opening message sent to the user's DMs.",
+				Required:    true,
+				MaxLength:   4000,
+			},
+			{
+				Type:         discordgo.ApplicationCommandOptionString,
+				Name:         "department",
+				Description:  "The department handling the ticket (defaults to General).",
+				Autocomplete: true,
+			},
+		},
+	},
+	{
+		Name:                     "claim",
+		Description:              "Claim a ModMail ticket",
+		DefaultMemberPermissions: &staffCommandPermissions,
+		DMPermission:             &guildOnly,
+	},
+	{
+		Name:                     "close",
+		Description:              "Close the current ModMail ticket (preserves channel)",
+		DefaultMemberPermissions: &staffCommandPermissions,
+		DMPermission:             &guildOnly,
+	},
+	{
+		Name:                     "delete",
+		Description:              "Close and permanently delete the current ModMail ticket",
+		DefaultMemberPermissions: &staffCommandPermissions,
+		DMPermission:             &guildOnly,
 	},
 }
 
-func registerCommands(s *discordgo.Session, guildID string) {
-	log.Println("Registering commands...")
-	for _, v := range commands {
-		_, err := s.ApplicationCommandCreate(s.State.User.ID, guildID, v)
-		if err != nil {
-			log.Fatalf("Cannot create command '%s': %v", v.Name, err)
+// syncCommands makes the guild's registered commands match the commands slice. It compares
+// the desired definitions with what Discord already has and only bulk-overwrites when
+// something differs, so restarts and deploys never leave the guild without commands.
+func syncCommands(s *discordgo.Session, guildID string) error {
+	registered, err := s.ApplicationCommands(s.State.User.ID, guildID)
+	if err != nil {
+		return fmt.Errorf("listing commands: %w", err)
+	}
+
+	added, changed, removed := diffCommands(commands, registered)
+	if len(added)+len(changed)+len(removed) == 0 {
+		slog.Info("Commands are up to date", "guild_id", guildID)
+		return nil
+	}
+
+	slog.Info("Syncing commands", "guild_id", guildID, "added", added, "changed", changed, "removed", removed)
+	if _, err := s.ApplicationCommandBulkOverwrite(s.State.User.ID, guildID, commands); err != nil {
+		return fmt.Errorf("overwriting commands: %w", err)
+	}
+	slog.Info("Commands synced", "guild_id", guildID)
+	return nil
+}
+
+// diffCommands returns the names of commands that are missing from Discord, differ from the
+// desired definition, or are registered but no longer wanted.
+func diffCommands(desired, registered []*discordgo.ApplicationCommand) (added, changed, removed []string) {
+	existing := make(map[string]*discordgo.ApplicationCommand, len(registered))
+	for _, cmd := range registered {
+		existing[cmd.Name] = cmd
+	}
+
+	wanted := make(map[string]bool, len(desired))
+	for _, cmd := range desired {
+		wanted[cmd.Name] = true
+		current, ok := existing[cmd.Name]
+		if !ok {
+			added = append(added, cmd.Name)
+		} else if commandSignature(cmd) != commandSignature(current) {
+			changed = append(changed, cmd.Name)
+		}
+	}
+	for _, cmd := range registered {
+		if !wanted[cmd.Name] {
+			removed = append(removed, cmd.Name)
 		}
 	}
-	log.Println("Commands registered.")
+	return added, changed, removed
+}
+
+// commandSignature renders the parts of a command Discord stores in a canonical form, so a
+// local definition and the copy returned by the API compare equal when nothing changed.
+// DMPermission is left out because Discord ignores it for guild commands.
+func commandSignature(cmd *discordgo.ApplicationCommand) string {
+	var b strings.Builder
+	cmdType := cmd.Type
+	if cmdType == 0 {
+		cmdType = discordgo.ChatApplicationCommand
+	}
+	fmt.Fprintf(&b, "%d|%s|%s|", cmdType, cmd.Name, cmd.Description)
+	if cmd.DefaultMemberPermissions != nil {
+		fmt.Fprintf(&b, "perms=%d|", *cmd.DefaultMemberPermissions)
+	}
+	if cmd.NSFW != nil && *cmd.NSFW {
+		b.WriteString("nsfw|")
+	}
+	writeOptionSignatures(&b, cmd.Options)
+	return b.String()
 }
 
-func deregisterCommands(s *discordgo.Session, guildID string) {
-	registeredCommands, _ := s.ApplicationCommands(s.State.User.ID, guildID)
-	log.Println("Deregistering commands...")
-	for _, v := range registeredCommands {
-		s.ApplicationCommandDelete(s.State.User.ID, guildID, v.ID)
+func writeOptionSignatures(b *strings.Builder, options []*discordgo.ApplicationCommandOption) {
+	for _, o := range options {
+		fmt.Fprintf(b, "[%d|%s|%s|req=%t|auto=%t|ch=%v|max=%v|maxlen=%d", o.Type, o.Name, o.Description, o.Required, o.Autocomplete, o.ChannelTypes, o.MaxValue, o.MaxLength)
+		if o.MinValue != nil {
+			fmt.Fprintf(b, "|min=%v", *o.MinValue)
+		}
+		if o.MinLength != nil {
+			fmt.Fprintf(b, "|minlen=%d", *o.MinLength)
+		}
+		for _, c := range o.Choices {
+			fmt.Fprintf(b, "|choice=%s:%v", c.Name, c.Value)
+		}
+		writeOptionSignatures(b, o.Options)
+		b.WriteString("]")
 	}
-	log.Println("Commands deregistered.")
 }
 
 // --- Command Handlers ---
 
 func handleSetupCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	// FIX: Corrected bitwise operation for permission check
-	if i.Member.Permissions&discordgo.PermissionAdministrator == 0 {
-		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: "❌ You must be an administrator to run this command.",
-				Flags:   discordgo.MessageFlagsEphemeral,
-			},
-		})
+	options := i.ApplicationCommandData().Options
+	if len(options) > 0 && options[0].Name == "wizard" {
+		handleSetupWizardCommand(s, i)
 		return
 	}
-	
-	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+	handleSetupCheckCommand(s, i)
+}
+
+func handleSetupCheckCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	gc := cfg.guild(i.GuildID)
+	if gc == nil {
+		gc = &GuildConfig{}
+	}
+
+	results := runSetupChecks(s, i.GuildID)
+	lines := make([]string, 0, len(results))
+	failed := 0
+	for _, r := range results {
+		lines = append(lines, r.String())
+		if !r.ok {
+			failed++
+		}
+	}
+
+	title, color := "✅ ModMail Setup Looks Good", 0x00FF00 // Green
+	if failed > 0 {
+		title, color = fmt.Sprintf("❌ ModMail Setup: %d problem(s) found", failed), 0xFF0000 // Red
+	}
+
+	respond(s, i, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: fmt.Sprintf("✅ **Current Config Status:**\n- Category ID: `%s`\n- Log Channel ID: `%s`\n- Staff Role ID: `%s`\n\nUse `/modmail-set-config` to change these settings.",
-				cfg.ModMailCategoryID, cfg.LogChannelID, cfg.StaffRoleID),
-			Flags:   discordgo.MessageFlagsEphemeral,
+			Embeds: []*discordgo.MessageEmbed{{
+				Title:       title,
+				Description: truncate(strings.Join(lines, "\n"), 4096),
+				Fields: []*discordgo.MessageEmbedField{{
+					Name: "Current Config",
+					Value: truncate(fmt.Sprintf("- Category ID: `%s`\n- Log Channel ID: `%s`\n- Staff Role ID: `%s`\n%s\nUse `/modmail-set-config` or `/modmail-setup wizard` to change these settings.",
+						gc.ModMailCategoryID, gc.LogChannelID, gc.StaffRoleID, departmentSummary(gc)), 1024),
+				}},
+				Color: color,
+			}},
+			Flags: discordgo.MessageFlagsEphemeral,
 		},
 	})
 }
 
-func handleSetConfigCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	// FIX: Corrected bitwise operation for permission check
-	if i.Member.Permissions&discordgo.PermissionAdministrator == 0 {
-		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
-			Type: discordgo.InteractionResponseChannelMessageWithSource,
-			Data: &discordgo.InteractionResponseData{
-				Content: "❌ You must be an administrator to run this command.",
-				Flags:   discordgo.MessageFlagsEphemeral,
-			},
-		})
-		return
+// truncate shortens text to fit Discord's embed limits.
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit-1]) + "…"
+}
+
+// departmentSummary lists a guild's departments for the setup status message.
+func departmentSummary(gc *GuildConfig) string {
+	if len(gc.Departments) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n**Departments:**\n")
+	for _, d := range gc.Departments {
+		dept := gc.department(d.ID)
+		where := fmt.Sprintf("Category `%s`", dept.CategoryID)
+		if gc.TicketMode == TicketModeForum || gc.TicketMode == TicketModeThread {
+			where = fmt.Sprintf("Parent Channel `%s`", dept.ThreadParentID)
+		}
+		fmt.Fprintf(&b, "- %s (`%s`): %s, Staff Role `%s`, Log Channel `%s`\n",
+			dept.Name, dept.ID, where, dept.StaffRoleID, dept.LogChannelID)
 	}
+	return b.String()
+}
 
+func handleSetConfigCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
 	options := i.ApplicationCommandData().Options
 	var categoryID, logChannelID, staffRoleID string
 
@@ -124,30 +406,171 @@ func handleSetConfigCommand(s *discordgo.Session, i *discordgo.InteractionCreate
 		}
 	}
     
-    cfg.ModMailCategoryID = categoryID
-    cfg.LogChannelID = logChannelID
-    cfg.StaffRoleID = staffRoleID
-    cfg.SaveConfig()
+	before, _, _ := cfg.updateGuild(i.GuildID, func(gc *GuildConfig) error {
+		gc.ModMailCategoryID = categoryID
+		gc.LogChannelID = logChannelID
+		gc.StaffRoleID = staffRoleID
+		return nil
+	})
+	saveGuildConfig(s, i.GuildID, before, i.Member.User, "/modmail-set-config")
     
-	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+	respond(s, i, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
 			Content: fmt.Sprintf("✅ **ModMail Configuration Updated!**\n"+
 				"* Category ID: `%s`\n"+
 				"* Log Channel ID: `%s`\n"+
 				"* Staff Role ID: `%s`\n\n"+
-				"The changes are now persistent. The bot is ready to receive DMs!",
-				categoryID, logChannelID, staffRoleID),
+				"The changes are now persistent. The bot is ready to receive DMs!%s",
+				categoryID, logChannelID, staffRoleID, pinnedNote(i.GuildID, "ModMailCategoryID", "LogChannelID", "StaffRoleID")),
 			Flags: discordgo.MessageFlagsEphemeral,
 		},
 	})
 }
 
+// handleContactCommand opens a staff-initiated ticket and sends the opening message to the user.
+func handleContactCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	gc := cfg.guild(i.GuildID)
+	if !gc.isConfigured() {
+		respondEphemeral(s, i, "❌ ModMail is not configured in this server. Use `/modmail-set-config` first.")
+		return
+	}
+
+	var target *discordgo.User
+	var message, deptID string
+	for _, option := range i.ApplicationCommandData().Options {
+		switch option.Name {
+		case "user":
+			target = option.UserValue(s)
+		case "message":
+			message = option.StringValue()
+		case "department":
+			deptID = option.StringValue()
+		}
+	}
+
+	if deptID != "" && !gc.hasDepartment(deptID) {
+		respondEphemeral(s, i, fmt.Sprintf("❌ Unknown department `%s`.", deptID))
+		return
+	}
+	dept := gc.department(deptID)
+
+	if !isStaff(i.Member, gc, dept) {
+		respondEphemeral(s, i, "❌ You must be staff in this department to contact users.")
+		return
+	}
+	if target == nil || target.Bot {
+		respondEphemeral(s, i, "❌ You can only contact real users.")
+		return
+	}
+	if existing, ok := activeTickets.forUser(target.ID); ok {
+		respondEphemeral(s, i, fmt.Sprintf("❌ **%s** already has an open ticket: <#%s>", target.String(), existing.ChannelID))
+		return
+	}
+
+	// Creating the channel and DMing the user can take longer than the interaction deadline.
+	respond(s, i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{Flags: discordgo.MessageFlagsEphemeral},
+	})
+
+	ticket, err := createNewTicket(s, i.GuildID, target, dept, i.Member.User)
+	if errors.Is(err, errTicketExists) {
+		// Someone else opened one since the check above.
+		if ticket != nil {
+			editInteractionResponse(s, i, fmt.Sprintf("❌ **%s** already has an open ticket: <#%s>", target.String(), ticket.ChannelID))
+		} else {
+			editInteractionResponse(s, i, fmt.Sprintf("❌ A ticket is already being opened for **%s**.", target.String()))
+		}
+		return
+	}
+	if err != nil {
+		interactionLog(i).Error("Error creating staff-initiated ticket", "target_id", target.ID, "err", err)
+		editInteractionResponse(s, i, "❌ Couldn't create the ticket. Staff configuration may be incomplete.")
+		return
+	}
+
+	logger := ticketLog(ticket).With("staff_id", i.Member.User.ID)
+	staffEmbed := createMessageEmbed(i.Member.User, message, "Staff Message", 0xFF8C00) // Dark Orange
+	sendEmbed(s, logger, ticket.ChannelID, staffEmbed)
+
+	userEmbed := createMessageEmbed(i.Member.User, message, "Staff Message", 0xFF8C00)
+	userEmbed.Description += "\n\n*Reply to this message to respond to the staff team.*"
+	dmChannel, err := s.UserChannelCreate(target.ID)
+	if err == nil {
+		_, err = s.ChannelMessageSendEmbed(dmChannel.ID, userEmbed)
+	}
+	if err != nil {
+		logger.Error("Error sending contact message", "err", err)
+		recordRelayFailure("to_user", err)
+		sendMessage(s, logger, ticket.ChannelID, "⚠️ Could not DM the user. They may have DMs disabled.")
+		editInteractionResponse(s, i, fmt.Sprintf("⚠️ Ticket opened at <#%s>, but the user could not be DMed.", ticket.ChannelID))
+		return
+	}
+
+	publish(s, MessageRelayed{Ticket: *ticket, Message: newTranscriptMessage(i.Member.User, true, message, nil)})
+	editInteractionResponse(s, i, fmt.Sprintf("✅ Ticket opened with **%s**: <#%s>", target.String(), ticket.ChannelID))
+}
+
+// handleDepartmentAutocomplete suggests the guild's departments for a department option.
+func handleDepartmentAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	var typed string
+	for _, option := range i.ApplicationCommandData().Options {
+		if option.Focused {
+			typed = strings.ToLower(option.StringValue())
+		}
+	}
+
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	if gc := cfg.guild(i.GuildID); gc != nil {
+		for _, d := range gc.Departments {
+			if typed != "" && !strings.Contains(strings.ToLower(d.Name), typed) && !strings.Contains(strings.ToLower(d.ID), typed) {
+				continue
+			}
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: d.Name, Value: d.ID})
+			if len(choices) == 25 {
+				break
+			}
+		}
+	}
+
+	respond(s, i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+}
+
+// inTicketChannel reports whether an interaction was used in one of the guild's ticket
+// channels or threads.
+func inTicketChannel(s *discordgo.Session, i *discordgo.InteractionCreate) bool {
+	channel, err := fetchChannel(s, i.ChannelID)
+	if err != nil {
+		interactionLog(i).Warn("Error fetching channel", "err", err)
+	}
+	return cfg.guild(i.GuildID).isTicketChannel(channel)
+}
+
+// respondEphemeral replies to an interaction with a message only the invoker can see.
+func respondEphemeral(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	respond(s, i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: content,
+			Flags:   discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
+
+// editInteractionResponse replaces the content of a deferred interaction response.
+func editInteractionResponse(s *discordgo.Session, i *discordgo.InteractionCreate, content string) {
+	if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{Content: &content}); err != nil {
+		interactionLog(i).Error("Error editing interaction response", "err", err)
+	}
+}
 
 func handleClaimCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	channel, _ := s.State.Channel(i.ChannelID)
-	if channel.ParentID != cfg.ModMailCategoryID {
-		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+	if !inTicketChannel(s, i) {
+		respond(s, i, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
 				Content: "❌ This command can only be used in a ModMail ticket channel.",
@@ -157,18 +580,21 @@ func handleClaimCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		return
 	}
 
-	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+	respond(s, i, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
 			Content: fmt.Sprintf("✅ Ticket claimed by **%s**.", i.Member.User.String()),
 		},
 	})
+
+	if ticket, ok := setTicketStatus(s, i.ChannelID, StatusClaimed, i.Member.User.ID); ok {
+		publish(s, TicketClaimed{Ticket: *ticket, By: i.Member.User})
+	}
 }
 
 func handleCloseCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	channel, _ := s.State.Channel(i.ChannelID)
-	if channel.ParentID != cfg.ModMailCategoryID {
-		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+	if !inTicketChannel(s, i) {
+		respond(s, i, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
 				Content: "❌ This command can only be used in a ModMail ticket channel.",
@@ -178,35 +604,21 @@ func handleCloseCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		return
 	}
 	
-	var userID string
-	for uid, cid := range activeTickets {
-		if cid == i.ChannelID {
-			userID = uid
-			break
-		}
-	}
-	
-	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+	respond(s, i, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
 			Content: "✅ Closing ticket... Logging transcript and archiving channel (channel remains visible).",
 		},
 	})
-	
-	if userID != "" {
-		user, _ := s.User(userID)
-		dmChannel, _ := s.UserChannelCreate(userID)
-		s.ChannelMessageSend(dmChannel.ID, fmt.Sprintf(
-			"🔒 Your support ticket has been closed by **%s**. It may be reopened if needed.", i.Member.User.String(),
-		))
-		logTranscript(s, i.ChannelID, user, "Closed by staff: "+i.Member.User.String())
+
+	if err := closeTicket(s, i.ChannelID, i.Member.User); err != nil && err != errNoTicket {
+		interactionLog(i).Error("Error closing ticket", "err", err)
 	}
 }
 
 func handleDeleteCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
-	channel, _ := s.State.Channel(i.ChannelID)
-	if channel.ParentID != cfg.ModMailCategoryID {
-		s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+	if !inTicketChannel(s, i) {
+		respond(s, i, &discordgo.InteractionResponse{
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
 				Content: "❌ This command can only be used in a ModMail ticket channel.",
@@ -216,32 +628,31 @@ func handleDeleteCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		return
 	}
 	
-	var userID string
-	for uid, cid := range activeTickets {
-		if cid == i.ChannelID {
-			userID = uid
-			break
-		}
-	}
+	ticket, ok := activeTickets.forChannel(i.ChannelID)
 	
-	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+	respond(s, i, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
 			Content: "🗑️ Deleting ticket... Logging transcript and permanently removing channel.",
 		},
 	})
 	
-	if userID != "" {
-		user, _ := s.User(userID)
-		
-		dmChannel, _ := s.UserChannelCreate(userID)
-		s.ChannelMessageSend(dmChannel.ID, fmt.Sprintf(
-			"🔒 Your support ticket has been closed and deleted by **%s**.", i.Member.User.String(),
-		))
+	if ok {
+		dmChannel, err := s.UserChannelCreate(ticket.UserID)
+		if err == nil {
+			_, err = s.ChannelMessageSend(dmChannel.ID, fmt.Sprintf(
+				"🔒 Your support ticket has been closed and deleted by **%s**.", i.Member.User.String(),
+			))
+		}
+		if err != nil {
+			ticketLog(ticket).Error("Error notifying user that their ticket was deleted", "err", err)
+		}
 		
-		logTranscript(s, i.ChannelID, user, "Deleted by staff: "+i.Member.User.String())
+		endTicket(s, i.ChannelID, i.Member.User, "Deleted by staff: "+i.Member.User.String(), true)
 	}
 
 	// Delete the channel immediately after logging/responding
-	s.ChannelDelete(i.ChannelID)
+	if _, err := s.ChannelDelete(i.ChannelID); err != nil {
+		interactionLog(i).Error("Error deleting ticket channel", "err", err)
+	}
 }
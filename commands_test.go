@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// registeredCopy returns the commands as the Discord API hands them back: decoded from JSON,
+// with IDs filled in, the type made explicit and DMPermission dropped.
+func registeredCopy(t *testing.T, cmds []*discordgo.ApplicationCommand) []*discordgo.ApplicationCommand {
+	t.Helper()
+	data, err := json.Marshal(cmds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []*discordgo.ApplicationCommand
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, cmd := range out {
+		cmd.ID = "100" + cmd.Name
+		cmd.ApplicationID = "42"
+		cmd.Version = "1"
+		cmd.DMPermission = nil
+		if cmd.Type == 0 {
+			cmd.Type = discordgo.ChatApplicationCommand
+		}
+	}
+	return out
+}
+
+func TestDiffCommandsUnchanged(t *testing.T) {
+	added, changed, removed := diffCommands(commands, registeredCopy(t, commands))
+	if len(added)+len(changed)+len(removed) != 0 {
+		t.Errorf("diffCommands reported differences for identical commands: added %v, changed %v, removed %v", added, changed, removed)
+	}
+}
+
+func TestDiffCommands(t *testing.T) {
+	perms := int64(discordgo.PermissionManageChannels)
+	desired := []*discordgo.ApplicationCommand{
+		{Name: "close", Description: "Close the ticket"},
+		{Name: "reply", Description: "Reply to the user", Options: []*discordgo.ApplicationCommandOption{
+			{Type: discordgo.ApplicationCommandOptionString, Name: "message", Description: "Message", Required: true},
+		}},
+		{Name: "setup", Description: "Set up ModMail", DefaultMemberPermissions: &perms},
+		{Name: "new", Description: "A new command"},
+	}
+	registered := registeredCopy(t, desired[:3])
+	registered[1].Options[0].Required = false
+	registered = append(registered, &discordgo.ApplicationCommand{Name: "old", Description: "A retired command"})
+
+	added, changed, removed := diffCommands(desired, registered)
+	if want := []string{"new"}; !reflect.DeepEqual(added, want) {
+		t.Errorf("added = %v, want %v", added, want)
+	}
+	if want := []string{"reply"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed = %v, want %v", changed, want)
+	}
+	if want := []string{"old"}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed = %v, want %v", removed, want)
+	}
+}
+
+func TestCommandSignature(t *testing.T) {
+	perms := int64(discordgo.PermissionManageChannels)
+	otherPerms := int64(discordgo.PermissionAdministrator)
+	minLen := 1
+	base := func() *discordgo.ApplicationCommand {
+		p := perms
+		return &discordgo.ApplicationCommand{
+			Name:                     "note",
+			Description:              "Add a note",
+			DefaultMemberPermissions: &p,
+			Options: []*discordgo.ApplicationCommandOption{{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        "text",
+				Description: "Note text",
+				Choices:     []*discordgo.ApplicationCommandOptionChoice{{Name: "one", Value: 1}},
+			}},
+		}
+	}
+
+	same := map[string]func(*discordgo.ApplicationCommand){
+		"explicit chat type": func(c *discordgo.ApplicationCommand) { c.Type = discordgo.ChatApplicationCommand },
+		"dm permission":      func(c *discordgo.ApplicationCommand) { dm := false; c.DMPermission = &dm },
+		"ids":                func(c *discordgo.ApplicationCommand) { c.ID, c.ApplicationID, c.Version = "1", "2", "3" },
+		"float choice":       func(c *discordgo.ApplicationCommand) { c.Options[0].Choices[0].Value = float64(1) },
+	}
+	for name, mutate := range same {
+		cmd := base()
+		mutate(cmd)
+		if commandSignature(cmd) != commandSignature(base()) {
+			t.Errorf("%s: signature changed but Discord treats the command as the same", name)
+		}
+	}
+
+	different := map[string]func(*discordgo.ApplicationCommand){
+		"description":       func(c *discordgo.ApplicationCommand) { c.Description = "Add a staff note" },
+		"permissions":       func(c *discordgo.ApplicationCommand) { c.DefaultMemberPermissions = &otherPerms },
+		"no permissions":    func(c *discordgo.ApplicationCommand) { c.DefaultMemberPermissions = nil },
+		"option required":   func(c *discordgo.ApplicationCommand) { c.Options[0].Required = true },
+		"option min length": func(c *discordgo.ApplicationCommand) { c.Options[0].MinLength = &minLen },
+		"option choice":     func(c *discordgo.ApplicationCommand) { c.Options[0].Choices[0].Value = 2 },
+		"option removed":    func(c *discordgo.ApplicationCommand) { c.Options = nil },
+		"message command":   func(c *discordgo.ApplicationCommand) { c.Type = discordgo.MessageApplicationCommand },
+		"nested option": func(c *discordgo.ApplicationCommand) {
+			c.Options[0].Options = []*discordgo.ApplicationCommandOption{{Name: "sub"}}
+		},
+	}
+	for name, mutate := range different {
+		cmd := base()
+		mutate(cmd)
+		if commandSignature(cmd) == commandSignature(base()) {
+			t.Errorf("%s: signature did not change", name)
+		}
+	}
+}
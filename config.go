@@ -1,59 +1,428 @@
 package main
 
 import (
-	"encoding/json"
-	"log"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 )
 
 // Configuration struct to hold settings loaded from environment variables/file
 type Config struct {
-	BotToken          string
-	GuildID           string // The main server ID where modmail operates
-	ModMailCategoryID string // Category ID where ticket channels will be created
-	LogChannelID      string // Channel ID for transcripts and logs
-	StaffRoleID       string // Role ID that can interact with tickets
+	Version int                     // Schema version; see configMigrations
+	Secrets Secrets                 `json:"-"` // Credentials; loaded separately and never saved
+	GuildID string                  // Optional guild that legacy single-server settings belong to
+	Guilds  map[string]*GuildConfig // Per-server settings keyed by guild ID
+
+	migrated bool     // Loaded from an older schema version and not saved since
+	env      envLayer // Guild settings pinned by environment variables; never saved
+}
+
+// cfgMu guards cfg.Guilds, which a reload replaces wholesale, and the config file. A
+// *GuildConfig is never changed once it is in the map: updateGuild publishes a changed copy,
+// so readers can keep using the pointer they got without locking.
+var cfgMu sync.RWMutex
+
+// lastConfigSum is the checksum of config.json as last loaded or saved, so the watcher can
+// tell edits apart from the bot's own writes.
+var lastConfigSum [sha256.Size]byte
+
+// GuildConfig holds the ModMail settings for one server.
+type GuildConfig struct {
+	ModMailCategoryID   string       // Category ID where ticket channels will be created
+	OverflowCategoryIDs []string     // Extra categories used once the main one is full
+	AutoCreateOverflow  bool         // Create numbered overflow categories when every category is full
+	LogChannelID        string       // Channel ID for transcripts and logs
+	OpsChannelID        string       // Optional channel where errors, panics and rate limits are reported
+	StaffRoleID         string       // Role ID that can interact with tickets
+	Departments         []Department // Optional teams users pick from when opening a ticket
+
+	StaffRoles    []StaffRole           // Roles granted a staff level (helper, moderator or admin)
+	CommandLevels map[string]StaffLevel // Minimum staff level per command, overriding the defaults
+
+	TicketMode     string                  // "channel" (default), "forum" or "thread"
+	ThreadParentID string                  // Forum channel (forum mode) or text channel (thread mode) holding ticket threads
+	ForumTagIDs    map[TicketStatus]string // Forum tag applied for each ticket status in forum mode
+
+	Webhooks []Webhook // Outgoing HTTP endpoints notified of ticket events
+}
+
+// Department routes tickets to a separate team. Empty fields fall back to the guild-level settings.
+type Department struct {
+	ID                  string   // Stable identifier stored on tickets and used as the select menu value
+	Name                string   // Label shown to users
+	Description         string   // Optional hint shown under the label in the select menu
+	CategoryID          string   // Category where this department's ticket channels are created
+	OverflowCategoryIDs []string // Extra categories used once CategoryID is full
+	StaffRoleID         string   // Role that handles this department's tickets
+	Greeting            string   // Message sent to the user once their ticket is opened
+	LogChannelID        string   // Channel for this department's transcripts and logs
+
+	ThreadParentID string                  // Forum or text channel for this department's ticket threads in forum or thread mode
+	ForumTagIDs    map[TicketStatus]string // Status tags of ThreadParentID in forum mode
 }
 
-const configFileName = "config.json"
+const defaultGreeting = "Thank you! A new support ticket has been opened. A staff member will respond shortly."
 
 // LoadConfig initializes the configuration from environment variables AND a configuration file.
-func LoadConfig() Config {
-	cfg := Config{
-		BotToken: os.Getenv("DISCORD_BOT_TOKEN"),
-		GuildID:  os.Getenv("DISCORD_GUILD_ID"),
+// A missing file is fine; a malformed or invalid one is an error rather than silently
+// falling back to defaults, which the next save would write over the file. Files written
+// for an older schema version are upgraded and saved back.
+func LoadConfig() (Config, error) {
+	cfg, data, err := readConfigFile()
+	if err != nil {
+		return Config{}, err
+	}
+	cfg.Secrets = loadSecrets()
+
+	if data == nil {
+		slog.Info("Config file not found. Configuration will be saved after setup.", "file", configFileName)
+		return cfg, nil
 	}
+	slog.Info("Configuration loaded", "file", configFileName)
+	lastConfigSum = sha256.Sum256(data)
+	if cfg.migrated {
+		slog.Info("Upgrading config file schema", "file", configFileName, "version", currentConfigVersion)
+		cfg.SaveConfig()
+	}
+	return cfg, nil
+}
 
+// readConfigFile parses, upgrades and validates the config file and applies environment
+// overrides. It returns the raw file contents, or nil if the file does not exist. Secrets
+// are not loaded.
+func readConfigFile() (Config, []byte, error) {
+	var cfg Config
 	data, err := os.ReadFile(configFileName)
+	if err != nil && !os.IsNotExist(err) {
+		return Config{}, nil, fmt.Errorf("reading %s: %w", configFileName, err)
+	}
 	if err == nil {
-		// Found config file, try to unmarshal
-		if err := json.Unmarshal(data, &cfg); err != nil {
-			log.Printf("Error unmarshalling config file: %v. Using defaults/ENV.", err)
-		} else {
-			log.Println("Configuration loaded from config.json.")
-		}
-	} else if !os.IsNotExist(err) {
-		log.Printf("Error reading config file: %v. Using defaults/ENV.", err)
-	} else {
-		log.Println("config.json not found. Configuration will be saved after setup.")
+		cfg, err = decodeConfig(data, configFormat(configFileName))
+		if err != nil {
+			return Config{}, nil, fmt.Errorf("parsing %s: %w", configFileName, err)
+		}
+	}
+
+	if cfg.Guilds == nil {
+		cfg.Guilds = make(map[string]*GuildConfig)
 	}
+	if err := cfg.applyEnvOverrides(); err != nil {
+		return Config{}, nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return Config{}, nil, fmt.Errorf("invalid %s: %w", configFileName, err)
+	}
+	return cfg, data, nil
+}
 
-	return cfg
+// validate reports settings that would break ticket handling if they were loaded.
+func (c *Config) validate() error {
+	var problems []string
+	for guildID, gc := range c.Guilds {
+		if gc == nil {
+			problems = append(problems, fmt.Sprintf("guild %s has no settings", guildID))
+			continue
+		}
+		for _, p := range gc.problems() {
+			problems = append(problems, fmt.Sprintf("guild %s: %s", guildID, p))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return errors.New(strings.Join(problems, "; "))
 }
 
-// SaveConfig writes the current configuration to a JSON file.
+// problems lists the guild's settings that would break ticket handling.
+func (gc *GuildConfig) problems() []string {
+	var problems []string
+	switch gc.TicketMode {
+	case "", TicketModeChannel, TicketModeForum, TicketModeThread:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown TicketMode %q", gc.TicketMode))
+	}
+	seen := make(map[string]bool)
+	for _, d := range gc.Departments {
+		switch {
+		case d.ID == "":
+			problems = append(problems, fmt.Sprintf("department %q has no ID", d.Name))
+		case seen[d.ID]:
+			problems = append(problems, fmt.Sprintf("duplicate department ID %q", d.ID))
+		}
+		seen[d.ID] = true
+	}
+	if names := gc.departmentsSharingParent(); len(names) > 0 {
+		problems = append(problems, fmt.Sprintf("departments %s have their own staff role but no ThreadParentID of their own in %s mode",
+			strings.Join(names, ", "), gc.TicketMode))
+	}
+	for _, w := range gc.Webhooks {
+		if err := w.validate(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	return problems
+}
+
+// clone returns a deep copy of the settings for updateGuild to change.
+func (gc *GuildConfig) clone() *GuildConfig {
+	out := *gc
+	out.OverflowCategoryIDs = append([]string(nil), gc.OverflowCategoryIDs...)
+	out.StaffRoles = append([]StaffRole(nil), gc.StaffRoles...)
+	out.CommandLevels = cloneMap(gc.CommandLevels)
+	out.ForumTagIDs = cloneMap(gc.ForumTagIDs)
+	out.Departments = nil
+	for _, d := range gc.Departments {
+		d.OverflowCategoryIDs = append([]string(nil), d.OverflowCategoryIDs...)
+		d.ForumTagIDs = cloneMap(d.ForumTagIDs)
+		out.Departments = append(out.Departments, d)
+	}
+	out.Webhooks = nil
+	for _, w := range gc.Webhooks {
+		w.Events = append([]string(nil), w.Events...)
+		out.Webhooks = append(out.Webhooks, w)
+	}
+	return &out
+}
+
+func cloneMap[K comparable, V any](m map[K]V) map[K]V {
+	if m == nil {
+		return nil
+	}
+	out := make(map[K]V, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// SaveConfig writes the current configuration to a JSON file readable only by the bot's user.
+// Secrets are not included.
 func (c *Config) SaveConfig() {
-	data, err := json.MarshalIndent(c, "", "  ")
+	cfgMu.Lock()
+	defer cfgMu.Unlock()
+
+	c.Version = currentConfigVersion
+	data, err := encodeConfig(c.persisted(), configFormat(configFileName))
 	if err != nil {
-		log.Printf("Error marshalling config: %v", err)
+		slog.Error("Error marshalling config", "err", err)
 		return
 	}
+	lastConfigSum = sha256.Sum256(data)
 
 	// Render allows writing to the current directory, which is non-ephemeral storage
-    // for this purpose (until the next build/deploy).
-	if err := os.WriteFile(configFileName, data, 0644); err != nil {
-		log.Printf("Error writing config file: %v", err)
+	// for this purpose (until the next build/deploy).
+	if err := writeFileAtomic(configFileName, data, 0600); err != nil {
+		slog.Error("Error writing config file", "file", configFileName, "err", err)
 	} else {
-		log.Println("Configuration successfully saved to config.json.")
+		c.migrated = false
+		slog.Info("Configuration saved", "file", configFileName)
+	}
+}
+
+// writeFileAtomic replaces a file by writing a temporary file next to it and renaming it
+// into place, so readers such as the config watcher see either the old or the new contents,
+// never a partial write.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// guild returns the settings for a guild, or nil if it has not been set up.
+func (c *Config) guild(guildID string) *GuildConfig {
+	cfgMu.RLock()
+	defer cfgMu.RUnlock()
+	return c.Guilds[guildID]
+}
+
+// updateGuild applies fn to a copy of the guild's settings, starting from empty settings
+// if there are none, and stores the copy unless fn returns an error. It returns the settings
+// before and after the change; before is nil for a new guild. fn runs under the config lock,
+// so it must not call back into cfg.
+func (c *Config) updateGuild(guildID string, fn func(gc *GuildConfig) error) (before, after *GuildConfig, err error) {
+	cfgMu.Lock()
+	defer cfgMu.Unlock()
+	before = c.Guilds[guildID]
+	after = &GuildConfig{}
+	if before != nil {
+		after = before.clone()
+	}
+	if err := fn(after); err != nil {
+		return before, before, err
+	}
+	c.pin(guildID, after)
+	c.Guilds[guildID] = after
+	return before, after, nil
+}
+
+// setGuild replaces a guild's settings and returns the previous ones. Environment overrides
+// still apply on top.
+func (c *Config) setGuild(guildID string, gc *GuildConfig) *GuildConfig {
+	cfgMu.Lock()
+	defer cfgMu.Unlock()
+	before := c.Guilds[guildID]
+	c.pin(guildID, gc)
+	c.Guilds[guildID] = gc
+	return before
+}
+
+// guilds returns a copy of the per-guild settings map.
+func (c *Config) guilds() map[string]*GuildConfig {
+	cfgMu.RLock()
+	defer cfgMu.RUnlock()
+	out := make(map[string]*GuildConfig, len(c.Guilds))
+	for id, gc := range c.Guilds {
+		out[id] = gc
+	}
+	return out
+}
+
+// isConfigured reports whether the guild has at least one place to create tickets.
+func (gc *GuildConfig) isConfigured() bool {
+	if gc == nil {
+		return false
+	}
+	if gc.TicketMode == TicketModeForum || gc.TicketMode == TicketModeThread {
+		return len(gc.threadParentIDs()) > 0
+	}
+	return len(gc.ticketCategoryIDs()) > 0
+}
+
+// department returns the department with the given ID, with unset fields filled in from
+// the guild-level settings. An empty or unknown ID resolves to the default department.
+func (gc *GuildConfig) department(id string) Department {
+	dept := Department{Name: "General"}
+	for _, d := range gc.Departments {
+		if d.ID == id && id != "" {
+			dept = d
+			break
+		}
+	}
+	if dept.CategoryID == "" {
+		// Overflow categories belong to the category they extend, so inherit them together.
+		dept.CategoryID = gc.ModMailCategoryID
+		dept.OverflowCategoryIDs = gc.OverflowCategoryIDs
+	}
+	if dept.ThreadParentID == "" {
+		// Forum tags belong to their forum, so they are inherited along with it.
+		dept.ThreadParentID = gc.ThreadParentID
+		dept.ForumTagIDs = gc.ForumTagIDs
+	}
+	if dept.StaffRoleID == "" {
+		dept.StaffRoleID = gc.StaffRoleID
+	}
+	if dept.LogChannelID == "" {
+		dept.LogChannelID = gc.LogChannelID
+	}
+	if dept.Greeting == "" {
+		dept.Greeting = defaultGreeting
+	}
+	return dept
+}
+
+// hasDepartment reports whether a department with the given ID is configured.
+func (gc *GuildConfig) hasDepartment(id string) bool {
+	for _, d := range gc.Departments {
+		if d.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// threadParentIDs lists every channel that may contain ticket threads.
+func (gc *GuildConfig) threadParentIDs() []string {
+	var ids []string
+	if gc.ThreadParentID != "" {
+		ids = append(ids, gc.ThreadParentID)
+	}
+	for _, d := range gc.Departments {
+		if d.ThreadParentID != "" {
+			ids = append(ids, d.ThreadParentID)
+		}
+	}
+	return ids
+}
+
+// departmentsSharingParent lists the departments that have their own staff role but, in
+// forum or thread mode, no parent channel of their own. Their tickets would land in the
+// guild's parent channel, visible to every department's staff.
+func (gc *GuildConfig) departmentsSharingParent() []string {
+	if gc.TicketMode != TicketModeForum && gc.TicketMode != TicketModeThread {
+		return nil
+	}
+	var names []string
+	for _, d := range gc.Departments {
+		if d.StaffRoleID != "" && d.StaffRoleID != gc.StaffRoleID && d.ThreadParentID == "" {
+			names = append(names, d.Name)
+		}
+	}
+	return names
+}
+
+// ticketCategoryIDs lists every category that may contain ticket channels.
+func (gc *GuildConfig) ticketCategoryIDs() []string {
+	var ids []string
+	if gc.ModMailCategoryID != "" {
+		ids = append(ids, gc.ModMailCategoryID)
+		ids = append(ids, gc.OverflowCategoryIDs...)
+	}
+	for _, d := range gc.Departments {
+		if d.CategoryID != "" {
+			ids = append(ids, d.CategoryID)
+			ids = append(ids, d.OverflowCategoryIDs...)
+		}
+	}
+	return ids
+}
+
+// addOverflowCategory records a newly created overflow category for a department. Departments
+// without their own category share the guild-level overflow list.
+func (gc *GuildConfig) addOverflowCategory(deptID, categoryID string) {
+	for i, d := range gc.Departments {
+		if d.ID == deptID && deptID != "" && d.CategoryID != "" {
+			gc.Departments[i].OverflowCategoryIDs = append(gc.Departments[i].OverflowCategoryIDs, categoryID)
+			return
+		}
+	}
+	gc.OverflowCategoryIDs = append(gc.OverflowCategoryIDs, categoryID)
+}
+
+// isTicketCategory reports whether channels under the given parent are ticket channels.
+func (gc *GuildConfig) isTicketCategory(parentID string) bool {
+	if gc == nil || parentID == "" {
+		return false
+	}
+	for _, id := range gc.ticketCategoryIDs() {
+		if id == parentID {
+			return true
+		}
 	}
+	return false
 }
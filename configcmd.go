@@ -0,0 +1,384 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// configKind decides how a /modmail-config value is parsed, validated and displayed.
+type configKind int
+
+const (
+	kindCategory configKind = iota
+	kindTextChannel
+	kindChannel // Any guild channel (forum or text, depending on ticket mode)
+	kindRole
+	kindBool
+	kindEnum
+	kindCategoryList
+	kindString
+)
+
+// configKey is one guild setting exposed through /modmail-config.
+type configKey struct {
+	name        string
+	field       string // GuildConfig field the key reads and writes
+	description string
+	kind        configKind
+	choices     []string // Allowed values for kindEnum
+	get         func(gc *GuildConfig) string
+	set         func(gc *GuildConfig, value string) // value is already validated; "" resets
+}
+
+var configKeys = []configKey{
+	{
+		name: "category", field: "ModMailCategoryID", description: "Category where ticket channels are created", kind: kindCategory,
+		get: func(gc *GuildConfig) string { return gc.ModMailCategoryID },
+		set: func(gc *GuildConfig, v string) { gc.ModMailCategoryID = v },
+	},
+	{
+		name: "overflow-categories", field: "OverflowCategoryIDs", description: "Extra categories used once the main one is full", kind: kindCategoryList,
+		get: func(gc *GuildConfig) string { return strings.Join(gc.OverflowCategoryIDs, ",") },
+		set: func(gc *GuildConfig, v string) { gc.OverflowCategoryIDs = splitList(v) },
+	},
+	{
+		name: "auto-create-overflow", field: "AutoCreateOverflow", description: "Create numbered overflow categories when all are full", kind: kindBool,
+		get: func(gc *GuildConfig) string { return strconv.FormatBool(gc.AutoCreateOverflow) },
+		set: func(gc *GuildConfig, v string) { gc.AutoCreateOverflow = v == "true" },
+	},
+	{
+		name: "log-channel", field: "LogChannelID", description: "Channel for transcripts and logs", kind: kindTextChannel,
+		get: func(gc *GuildConfig) string { return gc.LogChannelID },
+		set: func(gc *GuildConfig, v string) { gc.LogChannelID = v },
+	},
+	{
+		name: "ops-channel", field: "OpsChannelID", description: "Channel where bot errors are reported", kind: kindTextChannel,
+		get: func(gc *GuildConfig) string { return gc.OpsChannelID },
+		set: func(gc *GuildConfig, v string) { gc.OpsChannelID = v },
+	},
+	{
+		name: "staff-role", field: "StaffRoleID", description: "Role that can reply to tickets", kind: kindRole,
+		get: func(gc *GuildConfig) string { return gc.StaffRoleID },
+		set: func(gc *GuildConfig, v string) { gc.StaffRoleID = v },
+	},
+	{
+		name: "ticket-mode", field: "TicketMode", description: "Where tickets live: channel, forum or thread", kind: kindEnum,
+		choices: []string{TicketModeChannel, TicketModeForum, TicketModeThread},
+		get: func(gc *GuildConfig) string {
+			if gc.TicketMode == "" {
+				return TicketModeChannel
+			}
+			return gc.TicketMode
+		},
+		set: func(gc *GuildConfig, v string) { gc.TicketMode = v },
+	},
+	{
+		name: "thread-parent", field: "ThreadParentID", description: "Forum (forum mode) or text channel (thread mode) holding ticket threads", kind: kindChannel,
+		get: func(gc *GuildConfig) string { return gc.ThreadParentID },
+		set: func(gc *GuildConfig, v string) { gc.ThreadParentID = v },
+	},
+	forumTagKey(StatusOpen),
+	forumTagKey(StatusClaimed),
+	forumTagKey(StatusClosed),
+}
+
+func forumTagKey(status TicketStatus) configKey {
+	return configKey{
+		name: "forum-tag-" + string(status), field: "ForumTagIDs", description: fmt.Sprintf("Forum tag ID applied to %s tickets", status), kind: kindString,
+		get: func(gc *GuildConfig) string { return gc.ForumTagIDs[status] },
+		set: func(gc *GuildConfig, v string) {
+			if v == "" {
+				delete(gc.ForumTagIDs, status)
+				return
+			}
+			if gc.ForumTagIDs == nil {
+				gc.ForumTagIDs = make(map[TicketStatus]string)
+			}
+			gc.ForumTagIDs[status] = v
+		},
+	}
+}
+
+func findConfigKey(name string) (configKey, bool) {
+	for _, k := range configKeys {
+		if k.name == name {
+			return k, true
+		}
+	}
+	return configKey{}, false
+}
+
+// Mentions are accepted wherever an ID is: <#id> for channels, <@&id> for roles.
+var mentionPattern = regexp.MustCompile(`^<(?:#|@&)(\d+)>$`)
+
+func stripMention(value string) string {
+	value = strings.TrimSpace(value)
+	if m := mentionPattern.FindStringSubmatch(value); m != nil {
+		return m[1]
+	}
+	return value
+}
+
+// parseConfigValue validates a raw value for the key and returns it in stored form.
+func parseConfigValue(s *discordgo.Session, guildID string, key configKey, raw string) (string, error) {
+	switch key.kind {
+	case kindCategory, kindTextChannel, kindChannel:
+		return validateChannel(s, guildID, key.kind, stripMention(raw))
+	case kindCategoryList:
+		var ids []string
+		for _, part := range splitList(raw) {
+			id, err := validateChannel(s, guildID, kindCategory, stripMention(part))
+			if err != nil {
+				return "", err
+			}
+			ids = append(ids, id)
+		}
+		return strings.Join(ids, ","), nil
+	case kindRole:
+		id := stripMention(raw)
+		if _, err := s.State.Role(guildID, id); err != nil {
+			return "", fmt.Errorf("no role with ID `%s` in this server", id)
+		}
+		return id, nil
+	case kindBool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return "", fmt.Errorf("expected true or false")
+		}
+		return strconv.FormatBool(b), nil
+	case kindEnum:
+		value := strings.ToLower(strings.TrimSpace(raw))
+		for _, c := range key.choices {
+			if c == value {
+				return value, nil
+			}
+		}
+		return "", fmt.Errorf("expected one of: %s", strings.Join(key.choices, ", "))
+	default:
+		value := strings.TrimSpace(raw)
+		if value == "" {
+			return "", fmt.Errorf("value must not be empty; use reset to clear it")
+		}
+		return value, nil
+	}
+}
+
+func validateChannel(s *discordgo.Session, guildID string, kind configKind, id string) (string, error) {
+	ch, err := fetchChannel(s, id)
+	if err != nil || ch.GuildID != guildID {
+		return "", fmt.Errorf("no channel with ID `%s` in this server", id)
+	}
+	switch {
+	case kind == kindCategory && ch.Type != discordgo.ChannelTypeGuildCategory:
+		return "", fmt.Errorf("<#%s> is not a category", id)
+	case kind == kindTextChannel && ch.Type != discordgo.ChannelTypeGuildText:
+		return "", fmt.Errorf("<#%s> is not a text channel", id)
+	case kind == kindChannel && ch.Type != discordgo.ChannelTypeGuildText && ch.Type != discordgo.ChannelTypeGuildForum:
+		return "", fmt.Errorf("<#%s> must be a text or forum channel", id)
+	}
+	return id, nil
+}
+
+// displayConfigValue formats a stored value for chat, turning IDs into mentions.
+func displayConfigValue(key configKey, value string) string {
+	if value == "" {
+		return "*not set*"
+	}
+	switch key.kind {
+	case kindCategory, kindTextChannel, kindChannel:
+		return "<#" + value + ">"
+	case kindCategoryList:
+		parts := splitList(value)
+		for i, id := range parts {
+			parts[i] = "<#" + id + ">"
+		}
+		return strings.Join(parts, ", ")
+	case kindRole:
+		return "<@&" + value + ">"
+	default:
+		return "`" + value + "`"
+	}
+}
+
+func splitList(value string) []string {
+	var out []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// handleConfigCommand dispatches /modmail-config get|set|reset|history|rollback.
+func handleConfigCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	sub := i.ApplicationCommandData().Options[0]
+	var keyName, value string
+	var revision int
+	for _, option := range sub.Options {
+		switch option.Name {
+		case "key":
+			keyName = option.StringValue()
+		case "value":
+			value = option.StringValue()
+		case "revision":
+			revision = int(option.IntValue())
+		}
+	}
+
+	switch sub.Name {
+	case "history":
+		handleConfigHistoryCommand(s, i)
+		return
+	case "rollback":
+		handleConfigRollbackCommand(s, i, revision)
+		return
+	}
+
+	if sub.Name == "get" && keyName == "" {
+		respondEphemeral(s, i, configListing(i.GuildID, cfg.guild(i.GuildID)))
+		return
+	}
+
+	key, ok := findConfigKey(keyName)
+	if !ok {
+		respondEphemeral(s, i, fmt.Sprintf("❌ Unknown key `%s`. Use `/modmail-config get` to list keys.", keyName))
+		return
+	}
+
+	switch sub.Name {
+	case "get":
+		current := ""
+		if gc := cfg.guild(i.GuildID); gc != nil {
+			current = key.get(gc)
+		}
+		pinned := ""
+		if name := cfg.pinnedBy(i.GuildID, key.field); name != "" {
+			pinned = fmt.Sprintf("\n📌 Set by the `%s` environment variable, which overrides the config file.", name)
+		}
+		respondEphemeral(s, i, fmt.Sprintf("**%s**: %s\n*%s*%s", key.name, displayConfigValue(key, current), key.description, pinned))
+
+	case "set", "reset":
+		if name := cfg.pinnedBy(i.GuildID, key.field); name != "" {
+			respondEphemeral(s, i, fmt.Sprintf("❌ `%s` is set by the `%s` environment variable, which overrides the config file. Change or remove the variable instead.", key.name, name))
+			return
+		}
+		newValue := ""
+		if sub.Name == "set" {
+			parsed, err := parseConfigValue(s, i.GuildID, key, value)
+			if err != nil {
+				respondEphemeral(s, i, fmt.Sprintf("❌ Invalid value for `%s`: %v", key.name, err))
+				return
+			}
+			newValue = parsed
+		}
+
+		before, after, err := cfg.updateGuild(i.GuildID, func(gc *GuildConfig) error {
+			key.set(gc, newValue)
+			if problems := gc.problems(); len(problems) > 0 {
+				return errors.New(strings.Join(problems, "; "))
+			}
+			return nil
+		})
+		if err != nil {
+			respondEphemeral(s, i, fmt.Sprintf("❌ `%s` was not changed: %v", key.name, err))
+			return
+		}
+		saveGuildConfig(s, i.GuildID, before, i.Member.User, fmt.Sprintf("/modmail-config %s %s", sub.Name, key.name))
+		if before == nil {
+			before = &GuildConfig{}
+		}
+		oldValue, newValue := key.get(before), key.get(after)
+		interactionLog(i).Info("Config changed", "key", key.name, "old", oldValue, "new", newValue)
+
+		respondEphemeral(s, i, fmt.Sprintf("✅ **%s**: %s → %s", key.name, displayConfigValue(key, oldValue), displayConfigValue(key, newValue)))
+	}
+}
+
+// pinnedNote warns that some of the given GuildConfig fields are overridden by environment
+// variables, so the values just saved do not take effect. It returns "" if none are.
+func pinnedNote(guildID string, fields ...string) string {
+	var names []string
+	for _, field := range fields {
+		if name := cfg.pinnedBy(guildID, field); name != "" {
+			names = append(names, "`"+name+"`")
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return "\n\n📌 " + strings.Join(names, ", ") + " override the config file, so those settings were not changed."
+}
+
+// configListing shows every key with its current value, marking keys pinned by the environment.
+func configListing(guildID string, gc *GuildConfig) string {
+	if gc == nil {
+		gc = &GuildConfig{}
+	}
+	var b strings.Builder
+	b.WriteString("**ModMail configuration:**\n")
+	for _, k := range configKeys {
+		fmt.Fprintf(&b, "- `%s`: %s", k.name, displayConfigValue(k, k.get(gc)))
+		if name := cfg.pinnedBy(guildID, k.field); name != "" {
+			fmt.Fprintf(&b, " 📌 `%s`", name)
+		}
+		b.WriteByte('\n')
+	}
+	return truncate(b.String(), 2000)
+}
+
+// handleConfigAutocomplete suggests key names, and values for keys with a fixed set of choices.
+func handleConfigAutocomplete(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	options := i.ApplicationCommandData().Options
+	if len(options) == 0 {
+		return
+	}
+
+	var keyName string
+	var focused *discordgo.ApplicationCommandInteractionDataOption
+	for _, option := range options[0].Options {
+		if option.Name == "key" {
+			keyName = option.StringValue()
+		}
+		if option.Focused {
+			focused = option
+		}
+	}
+	if focused == nil {
+		return
+	}
+	typed := strings.ToLower(focused.StringValue())
+
+	var candidates []string
+	switch focused.Name {
+	case "key":
+		for _, k := range configKeys {
+			candidates = append(candidates, k.name)
+		}
+	case "value":
+		if key, ok := findConfigKey(keyName); ok {
+			switch key.kind {
+			case kindEnum:
+				candidates = key.choices
+			case kindBool:
+				candidates = []string{"true", "false"}
+			}
+		}
+	}
+
+	choices := []*discordgo.ApplicationCommandOptionChoice{}
+	for _, c := range candidates {
+		if strings.Contains(c, typed) && len(choices) < 25 {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{Name: c, Value: c})
+		}
+	}
+	respond(s, i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
+	})
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// currentConfigVersion is the schema version written by SaveConfig. Bump it together with a
+// new entry in configMigrations whenever the file layout changes incompatibly.
+const currentConfigVersion = 2
+
+// configMigrations upgrade a raw config file one version at a time: entry i turns version i
+// into version i+1. Files without a Version field are treated as version 0.
+var configMigrations = []func(raw map[string]any){
+	migrateSingleGuild, // 0 → 1: top-level settings move under Guilds
+	migrateDropSecrets, // 1 → 2: the bot token moves out of the config file
+}
+
+// configFileName is the config file in use: MODMAIL_CONFIG_FILE, or the first of
+// config.json, config.yaml, config.yml and config.toml that exists. The format follows
+// the extension.
+var configFileName = findConfigFile()
+
+func findConfigFile() string {
+	if path := os.Getenv("MODMAIL_CONFIG_FILE"); path != "" {
+		return path
+	}
+	for _, name := range []string{"config.json", "config.yaml", "config.yml", "config.toml"} {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	return "config.json"
+}
+
+func configFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	default:
+		return "json"
+	}
+}
+
+// decodeConfig parses a config file of any supported format into a JSON-shaped map,
+// upgrades it to the current schema version and decodes it into a Config.
+func decodeConfig(data []byte, format string) (Config, error) {
+	var parsed any
+	var err error
+	switch format {
+	case "yaml":
+		err = yaml.Unmarshal(data, &parsed)
+		parsed = stringKeys(parsed)
+	case "toml":
+		err = toml.Unmarshal(data, &parsed)
+	default:
+		err = json.Unmarshal(data, &parsed)
+	}
+	if err != nil {
+		return Config{}, err
+	}
+
+	// Round-trip through JSON so every format yields the same map and number types.
+	normalized, err := json.Marshal(parsed)
+	if err != nil {
+		return Config{}, err
+	}
+	// Numbers are kept as json.Number so large unquoted IDs don't lose digits.
+	raw := make(map[string]any)
+	dec := json.NewDecoder(bytes.NewReader(normalized))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return Config{}, fmt.Errorf("top level must be a mapping: %w", err)
+	}
+
+	version := 0
+	if v, ok := raw["Version"].(json.Number); ok {
+		n, err := v.Int64()
+		if err != nil {
+			return Config{}, fmt.Errorf("schema version %s is not a whole number", v)
+		}
+		version = int(n)
+	}
+	if version > currentConfigVersion {
+		return Config{}, fmt.Errorf("schema version %d is newer than this bot supports (%d)", version, currentConfigVersion)
+	}
+	migrated := version < currentConfigVersion
+	for ; version < currentConfigVersion; version++ {
+		configMigrations[version](raw)
+	}
+	raw["Version"] = currentConfigVersion
+	numbersAsStrings(raw, reflect.TypeOf(Config{}))
+
+	upgraded, err := json.Marshal(raw)
+	if err != nil {
+		return Config{}, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(upgraded, &cfg); err != nil {
+		return Config{}, err
+	}
+	cfg.migrated = migrated
+	return cfg, nil
+}
+
+// encodeConfig writes a Config in the given format.
+func encodeConfig(c *Config, format string) ([]byte, error) {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil || format == "json" {
+		return data, err
+	}
+
+	// Convert through a map so YAML and TOML use the same field names and value encodings.
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	tidyValues(raw, format == "toml")
+	if format == "yaml" {
+		return yaml.Marshal(raw)
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(raw); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// tidyValues turns JSON's whole-number floats back into integers and, for TOML, which has
+// no null, drops null values.
+func tidyValues(v any, dropNulls bool) any {
+	switch v := v.(type) {
+	case float64:
+		if v == float64(int64(v)) {
+			return int64(v)
+		}
+	case map[string]any:
+		for k, item := range v {
+			if item == nil && dropNulls {
+				delete(v, k)
+			} else {
+				v[k] = tidyValues(item, dropNulls)
+			}
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = tidyValues(item, dropNulls)
+		}
+	}
+	return v
+}
+
+// stringKeys turns the non-string mapping keys YAML produces, such as an unquoted guild ID,
+// into strings so the document can be converted to JSON.
+func stringKeys(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			v[k] = stringKeys(item)
+		}
+	case map[any]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			out[fmt.Sprint(k)] = stringKeys(item)
+		}
+		return out
+	case []any:
+		for i, item := range v {
+			v[i] = stringKeys(item)
+		}
+	}
+	return v
+}
+
+// numbersAsStrings converts numbers in a raw config to decimal strings wherever the field
+// they decode into is a string. Discord IDs are all digits, so YAML and TOML read them as
+// integers unless they are quoted.
+func numbersAsStrings(v any, t reflect.Type) any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch v := v.(type) {
+	case json.Number:
+		if t.Kind() == reflect.String {
+			return v.String()
+		}
+	case map[string]any:
+		for k, item := range v {
+			switch t.Kind() {
+			case reflect.Map:
+				v[k] = numbersAsStrings(item, t.Elem())
+			case reflect.Struct:
+				if field, ok := t.FieldByNameFunc(func(name string) bool { return strings.EqualFold(name, k) }); ok {
+					v[k] = numbersAsStrings(item, field.Type)
+				}
+			}
+		}
+	case []any:
+		if t.Kind() == reflect.Slice {
+			for i, item := range v {
+				v[i] = numbersAsStrings(item, t.Elem())
+			}
+		}
+	}
+	return v
+}
+
+// migrateSingleGuild moves the settings of a single-guild config file into the entry for
+// GuildID (DISCORD_GUILD_ID takes precedence over the file).
+func migrateSingleGuild(raw map[string]any) {
+	legacyKeys := []string{"ModMailCategoryID", "LogChannelID", "StaffRoleID", "Departments"}
+	defer func() {
+		for _, key := range legacyKeys {
+			delete(raw, key)
+		}
+	}()
+
+	if rawID(raw["ModMailCategoryID"]) == "" {
+		return
+	}
+	guildID := os.Getenv("DISCORD_GUILD_ID")
+	if guildID == "" {
+		guildID = rawID(raw["GuildID"])
+	}
+	if guildID == "" {
+		slog.Warn("Config file contains single-server settings but DISCORD_GUILD_ID is not set; ignoring them.")
+		return
+	}
+
+	guilds, _ := raw["Guilds"].(map[string]any)
+	if guilds == nil {
+		guilds = make(map[string]any)
+		raw["Guilds"] = guilds
+	}
+	if _, exists := guilds[guildID]; exists {
+		return
+	}
+	entry := make(map[string]any)
+	for _, key := range legacyKeys {
+		if value, ok := raw[key]; ok {
+			entry[key] = value
+		}
+	}
+	guilds[guildID] = entry
+	slog.Info("Migrated single-server settings", "guild_id", guildID)
+}
+
+// rawID returns an ID from a raw config, whether or not it was quoted.
+func rawID(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	return ""
+}
+
+// migrateDropSecrets removes the bot token, which is now loaded from the environment or
+// the secrets file only.
+func migrateDropSecrets(raw map[string]any) {
+	if token, _ := raw["BotToken"].(string); token != "" {
+		slog.Warn("Config file contains a bot token, which is no longer read from it. Removing it; set DISCORD_BOT_TOKEN or use a secrets file instead.")
+	}
+	delete(raw, "BotToken")
+}
+
+// Guild-specific overrides are named MODMAIL_<guild ID>_<FIELD>.
+var guildOverridePattern = regexp.MustCompile(`^MODMAIL_(\d+)_`)
+
+// envLayer holds the guild settings pinned by environment variables. They sit on top of the
+// file's settings: SaveConfig writes the file's own values for pinned fields, so an override
+// never ends up in the file and stops applying once its variable is removed.
+type envLayer struct {
+	byGuild map[string][]envOverride
+	envOnly map[string]bool // Guilds that only exist because of overrides
+}
+
+// envOverride is one GuildConfig field pinned by an environment variable.
+type envOverride struct {
+	field int           // Index of the GuildConfig field
+	name  string        // Environment variable
+	value string        // Its raw value, parsed again for every copy it is applied to
+	saved reflect.Value // The field's value from the file, written back by SaveConfig
+}
+
+// applyEnvOverrides sets guild settings from environment variables. Every GuildConfig field
+// can be overridden: MODMAIL_<FIELD> applies to GuildID's guild and MODMAIL_<guild ID>_<FIELD>
+// to a specific one, where FIELD is the field name in upper snake case (e.g.
+// MODMAIL_LOG_CHANNEL_ID). Lists are comma-separated; structured fields take JSON.
+// The overrides are recorded in c.env so they can be kept out of the saved file.
+func (c *Config) applyEnvOverrides() error {
+	c.env = envLayer{byGuild: make(map[string][]envOverride), envOnly: make(map[string]bool)}
+	if guildID := os.Getenv("DISCORD_GUILD_ID"); guildID != "" {
+		c.GuildID = guildID
+	}
+
+	guildIDs := make(map[string]bool)
+	if c.GuildID != "" {
+		guildIDs[c.GuildID] = true
+	}
+	for _, kv := range os.Environ() {
+		if m := guildOverridePattern.FindStringSubmatch(kv); m != nil {
+			guildIDs[m[1]] = true
+		}
+	}
+
+	var problems []string
+	gcType := reflect.TypeOf(GuildConfig{})
+	for guildID := range guildIDs {
+		var prefixes []string
+		if guildID == c.GuildID {
+			prefixes = append(prefixes, "MODMAIL_")
+		}
+		prefixes = append(prefixes, "MODMAIL_"+guildID+"_")
+
+		for i := 0; i < gcType.NumField(); i++ {
+			field := gcType.Field(i)
+			for _, prefix := range prefixes {
+				name := prefix + envName(field.Name)
+				value, ok := os.LookupEnv(name)
+				if !ok {
+					continue
+				}
+				gc := c.Guilds[guildID]
+				if gc == nil {
+					gc = &GuildConfig{}
+					c.Guilds[guildID] = gc
+					c.env.envOnly[guildID] = true
+				}
+				field := reflect.ValueOf(gc).Elem().Field(i)
+				saved := reflect.New(field.Type()).Elem()
+				saved.Set(field)
+				if err := setFromEnv(field, value); err != nil {
+					problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+					continue
+				}
+				c.env.byGuild[guildID] = append(c.env.byGuild[guildID], envOverride{field: i, name: name, value: value, saved: saved})
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("environment overrides: %s", strings.Join(problems, "; "))
+}
+
+// pin applies the guild's environment overrides to a new copy of its settings, so changes
+// made by staff or a rollback never replace a pinned value. Callers hold cfgMu.
+func (c *Config) pin(guildID string, gc *GuildConfig) {
+	for _, o := range c.env.byGuild[guildID] {
+		// The value parsed when the config was loaded, so this cannot fail.
+		_ = setFromEnv(reflect.ValueOf(gc).Elem().Field(o.field), o.value)
+	}
+}
+
+// pinnedBy returns the environment variable overriding a GuildConfig field in the guild, or
+// "" if the field is not overridden.
+func (c *Config) pinnedBy(guildID, field string) string {
+	cfgMu.RLock()
+	defer cfgMu.RUnlock()
+	for _, o := range c.env.byGuild[guildID] {
+		if reflect.TypeOf(GuildConfig{}).Field(o.field).Name == field {
+			return o.name
+		}
+	}
+	return ""
+}
+
+// persisted returns the config as it should be saved: pinned fields hold the file's own
+// values, and guilds that only exist because of overrides are left out unless staff have
+// since set something else. Callers hold cfgMu.
+func (c *Config) persisted() *Config {
+	out := *c
+	out.Guilds = make(map[string]*GuildConfig, len(c.Guilds))
+	for guildID, gc := range c.Guilds {
+		overrides := c.env.byGuild[guildID]
+		if len(overrides) == 0 || gc == nil {
+			out.Guilds[guildID] = gc
+			continue
+		}
+		saved := gc.clone()
+		for _, o := range overrides {
+			reflect.ValueOf(saved).Elem().Field(o.field).Set(o.saved)
+		}
+		if c.env.envOnly[guildID] && reflect.DeepEqual(saved, &GuildConfig{}) {
+			continue
+		}
+		out.Guilds[guildID] = saved
+	}
+	return &out
+}
+
+// envWords are spelled as one word in environment variable names.
+var envWords = strings.NewReplacer("ModMail", "Modmail", "IDs", "Ids")
+
+// envName turns a Go field name into upper snake case, keeping ModMail and a plural IDs as
+// one word: ModMailCategoryID → MODMAIL_CATEGORY_ID, ForumTagIDs → FORUM_TAG_IDS.
+func envName(field string) string {
+	runes := []rune(envWords.Replace(field))
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prevLower := unicode.IsLower(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1])
+			if prevLower || nextLower {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+func setFromEnv(field reflect.Value, value string) error {
+	switch {
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected true or false")
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		field.Set(reflect.ValueOf(splitList(value)).Convert(field.Type()))
+	default:
+		target := reflect.New(field.Type())
+		if err := json.Unmarshal([]byte(value), target.Interface()); err != nil {
+			return fmt.Errorf("expected JSON: %v", err)
+		}
+		field.Set(target.Elem())
+	}
+	return nil
+}
+
+// checkConfig validates the configuration and prints the effective settings, for
+// --check-config. It returns the process exit code.
+func checkConfig() int {
+	c, _, err := readConfigFile()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration is invalid: %v\n", err)
+		return 1
+	}
+	c.Secrets = loadSecrets()
+
+	format := configFormat(configFileName)
+	data, err := encodeConfig(&c, format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding configuration: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Configuration OK (%s, %s, schema version %d).\n\n%s\n", configFileName, format, currentConfigVersion, data)
+	if c.Secrets.BotToken == "" {
+		fmt.Fprintln(os.Stderr, "Bot token not set. Set DISCORD_BOT_TOKEN or put BotToken in the secrets file.")
+		return 1
+	}
+	fmt.Printf("Bot token: %s\n", c.Secrets.BotToken)
+	return 0
+}
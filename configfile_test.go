@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEnvName(t *testing.T) {
+	want := map[string]string{
+		"ModMailCategoryID":   "MODMAIL_CATEGORY_ID",
+		"OverflowCategoryIDs": "OVERFLOW_CATEGORY_IDS",
+		"AutoCreateOverflow":  "AUTO_CREATE_OVERFLOW",
+		"LogChannelID":        "LOG_CHANNEL_ID",
+		"OpsChannelID":        "OPS_CHANNEL_ID",
+		"StaffRoleID":         "STAFF_ROLE_ID",
+		"Departments":         "DEPARTMENTS",
+		"StaffRoles":          "STAFF_ROLES",
+		"CommandLevels":       "COMMAND_LEVELS",
+		"TicketMode":          "TICKET_MODE",
+		"ThreadParentID":      "THREAD_PARENT_ID",
+		"ForumTagIDs":         "FORUM_TAG_IDS",
+		"Webhooks":            "WEBHOOKS",
+	}
+
+	gcType := reflect.TypeOf(GuildConfig{})
+	for i := 0; i < gcType.NumField(); i++ {
+		field := gcType.Field(i).Name
+		expected, ok := want[field]
+		if !ok {
+			t.Errorf("GuildConfig.%s has no expected environment name; add it to this table", field)
+			continue
+		}
+		if got := envName(field); got != expected {
+			t.Errorf("envName(%q) = %q, want %q", field, got, expected)
+		}
+	}
+}
+
+func TestDecodeConfigMigrations(t *testing.T) {
+	t.Setenv("DISCORD_GUILD_ID", "")
+
+	tests := []struct {
+		name, format, data string
+	}{
+		{"v0 json", "json", `{"BotToken": "secret", "GuildID": "111", "ModMailCategoryID": "cat", "LogChannelID": "log", "StaffRoleID": "staff"}`},
+		{"v0 yaml", "yaml", "BotToken: secret\nGuildID: \"111\"\nModMailCategoryID: cat\nLogChannelID: log\nStaffRoleID: staff\n"},
+		{"v0 toml", "toml", "BotToken = \"secret\"\nGuildID = \"111\"\nModMailCategoryID = \"cat\"\nLogChannelID = \"log\"\nStaffRoleID = \"staff\"\n"},
+		{"v1", "json", `{"Version": 1, "BotToken": "secret", "Guilds": {"111": {"ModMailCategoryID": "cat", "LogChannelID": "log", "StaffRoleID": "staff"}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := decodeConfig([]byte(tt.data), tt.format)
+			if err != nil {
+				t.Fatalf("decodeConfig: %v", err)
+			}
+			if c.Version != currentConfigVersion || !c.migrated {
+				t.Errorf("Version = %d, migrated = %v; want %d, true", c.Version, c.migrated, currentConfigVersion)
+			}
+			want := &GuildConfig{ModMailCategoryID: "cat", LogChannelID: "log", StaffRoleID: "staff"}
+			if gc := c.Guilds["111"]; !reflect.DeepEqual(gc, want) {
+				t.Errorf("Guilds[111] = %+v, want %+v", gc, want)
+			}
+			data, err := encodeConfig(&c, "json")
+			if err != nil {
+				t.Fatalf("encodeConfig: %v", err)
+			}
+			if bytes.Contains(data, []byte("BotToken")) || bytes.Contains(data, []byte("secret")) {
+				t.Errorf("bot token survived the migration:\n%s", data)
+			}
+		})
+	}
+}
+
+func TestDecodeConfigKeepsExistingGuild(t *testing.T) {
+	t.Setenv("DISCORD_GUILD_ID", "")
+	data := `{"GuildID": "111", "ModMailCategoryID": "legacy", "Guilds": {"111": {"ModMailCategoryID": "current"}}}`
+	c, err := decodeConfig([]byte(data), "json")
+	if err != nil {
+		t.Fatalf("decodeConfig: %v", err)
+	}
+	if got := c.Guilds["111"].ModMailCategoryID; got != "current" {
+		t.Errorf("ModMailCategoryID = %q, want the guild entry's %q", got, "current")
+	}
+}
+
+func TestDecodeConfigCurrentVersion(t *testing.T) {
+	c, err := decodeConfig([]byte(`{"Version": 2, "Guilds": {"111": {"TicketMode": "forum"}}}`), "json")
+	if err != nil {
+		t.Fatalf("decodeConfig: %v", err)
+	}
+	if c.migrated {
+		t.Error("a current file was marked as migrated")
+	}
+	if got := c.Guilds["111"].TicketMode; got != TicketModeForum {
+		t.Errorf("TicketMode = %q, want %q", got, TicketModeForum)
+	}
+}
+
+func TestDecodeConfigNewerVersion(t *testing.T) {
+	if _, err := decodeConfig([]byte(`{"Version": 99}`), "json"); err == nil {
+		t.Error("decodeConfig accepted a schema version newer than it supports")
+	}
+}
+
+func TestSetFromEnv(t *testing.T) {
+	tests := []struct {
+		field, value string
+		want         any
+	}{
+		{"LogChannelID", "123", "123"},
+		{"AutoCreateOverflow", "true", true},
+		{"AutoCreateOverflow", "0", false},
+		{"OverflowCategoryIDs", " 1, 2,,3 ", []string{"1", "2", "3"}},
+		{"CommandLevels", `{"close": "admin"}`, map[string]StaffLevel{"close": LevelAdmin}},
+		{"Departments", `[{"ID": "billing", "Name": "Billing"}]`, []Department{{ID: "billing", Name: "Billing"}}},
+	}
+	for _, tt := range tests {
+		var gc GuildConfig
+		field := reflect.ValueOf(&gc).Elem().FieldByName(tt.field)
+		if err := setFromEnv(field, tt.value); err != nil {
+			t.Errorf("setFromEnv(%s, %q): %v", tt.field, tt.value, err)
+			continue
+		}
+		if got := field.Interface(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("setFromEnv(%s, %q) set %#v, want %#v", tt.field, tt.value, got, tt.want)
+		}
+	}
+
+	for field, value := range map[string]string{
+		"AutoCreateOverflow": "maybe",
+		"CommandLevels":      "close=admin",
+		"Departments":        `{"ID": "billing"}`,
+	} {
+		var gc GuildConfig
+		if err := setFromEnv(reflect.ValueOf(&gc).Elem().FieldByName(field), value); err == nil {
+			t.Errorf("setFromEnv(%s, %q) accepted an invalid value", field, value)
+		}
+	}
+}
+
+func TestEnvOverridesNotPersisted(t *testing.T) {
+	t.Setenv("DISCORD_GUILD_ID", "111")
+	t.Setenv("MODMAIL_LOG_CHANNEL_ID", "env-log")
+	t.Setenv("MODMAIL_222_OPS_CHANNEL_ID", "env-ops")
+
+	c := Config{Guilds: map[string]*GuildConfig{"111": {LogChannelID: "file-log", StaffRoleID: "staff"}}}
+	if err := c.applyEnvOverrides(); err != nil {
+		t.Fatalf("applyEnvOverrides: %v", err)
+	}
+	if got := c.Guilds["111"].LogChannelID; got != "env-log" {
+		t.Errorf("LogChannelID = %q, want the override", got)
+	}
+	if got := c.Guilds["222"].OpsChannelID; got != "env-ops" {
+		t.Errorf("OpsChannelID = %q, want the override", got)
+	}
+
+	saved := c.persisted()
+	if got := saved.Guilds["111"]; got.LogChannelID != "file-log" || got.StaffRoleID != "staff" {
+		t.Errorf("saved guild 111 = %+v, want the file's own values", got)
+	}
+	if _, ok := saved.Guilds["222"]; ok {
+		t.Error("a guild that only exists because of overrides was saved")
+	}
+	if got := c.Guilds["111"].LogChannelID; got != "env-log" {
+		t.Errorf("persisted changed the live settings: LogChannelID = %q", got)
+	}
+}
+
+func TestEnvOverrideInvalid(t *testing.T) {
+	t.Setenv("DISCORD_GUILD_ID", "111")
+	t.Setenv("MODMAIL_AUTO_CREATE_OVERFLOW", "sometimes")
+
+	c := Config{Guilds: map[string]*GuildConfig{}}
+	err := c.applyEnvOverrides()
+	if err == nil || !strings.Contains(err.Error(), "MODMAIL_AUTO_CREATE_OVERFLOW") {
+		t.Errorf("applyEnvOverrides error = %v, want one naming MODMAIL_AUTO_CREATE_OVERFLOW", err)
+	}
+}
+
+func TestDecodeConfigUnquotedIDs(t *testing.T) {
+	t.Setenv("DISCORD_GUILD_ID", "")
+
+	want := &GuildConfig{
+		ModMailCategoryID:   "123456789012345678",
+		OverflowCategoryIDs: []string{"223456789012345678", "323456789012345678"},
+		LogChannelID:        "423456789012345678",
+		AutoCreateOverflow:  true,
+		Departments:         []Department{{ID: "billing", Name: "Billing", CategoryID: "523456789012345678"}},
+		ForumTagIDs:         map[TicketStatus]string{StatusOpen: "623456789012345678"},
+	}
+	tests := []struct {
+		name, format, data string
+	}{
+		{"yaml", "yaml", `Version: 2
+Guilds:
+  999456789012345678:
+    ModMailCategoryID: 123456789012345678
+    OverflowCategoryIDs: [223456789012345678, 323456789012345678]
+    LogChannelID: 423456789012345678
+    AutoCreateOverflow: true
+    Departments:
+      - ID: billing
+        Name: Billing
+        CategoryID: 523456789012345678
+    ForumTagIDs:
+      open: 623456789012345678
+`},
+		{"toml", "toml", `Version = 2
+[Guilds.999456789012345678]
+ModMailCategoryID = 123456789012345678
+OverflowCategoryIDs = [223456789012345678, 323456789012345678]
+LogChannelID = 423456789012345678
+AutoCreateOverflow = true
+ForumTagIDs = { open = 623456789012345678 }
+
+[[Guilds.999456789012345678.Departments]]
+ID = "billing"
+Name = "Billing"
+CategoryID = 523456789012345678
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := decodeConfig([]byte(tt.data), tt.format)
+			if err != nil {
+				t.Fatalf("decodeConfig: %v", err)
+			}
+			if gc := c.Guilds["999456789012345678"]; !reflect.DeepEqual(gc, want) {
+				t.Errorf("Guilds[999456789012345678] = %+v, want %+v", gc, want)
+			}
+		})
+	}
+}
+
+func TestDecodeConfigUnquotedLegacyIDs(t *testing.T) {
+	t.Setenv("DISCORD_GUILD_ID", "")
+	data := "GuildID: 999456789012345678\nModMailCategoryID: 123456789012345678\nStaffRoleID: 223456789012345678\n"
+	c, err := decodeConfig([]byte(data), "yaml")
+	if err != nil {
+		t.Fatalf("decodeConfig: %v", err)
+	}
+	want := &GuildConfig{ModMailCategoryID: "123456789012345678", StaffRoleID: "223456789012345678"}
+	if gc := c.Guilds["999456789012345678"]; !reflect.DeepEqual(gc, want) {
+		t.Errorf("Guilds[999456789012345678] = %+v, want %+v", gc, want)
+	}
+	if c.GuildID != "999456789012345678" {
+		t.Errorf("GuildID = %q, want the unquoted ID", c.GuildID)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// closedTicketsShown caps the closed tickets listed on the dashboard's front page.
+const closedTicketsShown = 50
+
+// dashboardRow is one ticket in the dashboard tables.
+type dashboardRow struct {
+	Ticket       Ticket
+	Guild        string
+	Department   string
+	ClaimedBy    string
+	Age          string
+	LastActivity string
+	ClosedAt     string
+	Reason       string
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>ModMail Dashboard</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { text-align: left; padding: 6px 10px; border-bottom: 1px solid #ddd; }
+th { background: #f4f4f4; }
+.muted { color: #888; }
+</style></head><body>
+<h1>ModMail</h1>
+<form method="get" action="/dashboard"><input name="q" value="{{.Query}}" placeholder="Search users, IDs, messages"> <button>Search</button>{{if .Query}} <a href="/dashboard">Clear</a>{{end}}</form>
+
+<h2>Open Tickets ({{len .Open}})</h2>
+<table><tr><th>User</th><th>Server</th><th>Department</th><th>Status</th><th>Claimed By</th><th>Age</th><th>Idle For</th></tr>
+{{range .Open}}<tr><td><a href="/dashboard/ticket?id={{.Ticket.ChannelID}}">{{.Ticket.UserName}}</a> <span class="muted">{{.Ticket.UserID}}</span></td><td>{{.Guild}}</td><td>{{.Department}}</td><td>{{.Ticket.Status}}</td><td>{{.ClaimedBy}}</td><td>{{.Age}}</td><td>{{.LastActivity}}</td></tr>
+{{else}}<tr><td colspan="7" class="muted">No open tickets.</td></tr>{{end}}
+</table>
+
+<h2>Closed Tickets</h2>
+<table><tr><th>User</th><th>Server</th><th>Department</th><th>Closed</th><th>Reason</th></tr>
+{{range .Closed}}<tr><td><a href="/dashboard/ticket?id={{.Ticket.ChannelID}}">{{.Ticket.UserName}}</a> <span class="muted">{{.Ticket.UserID}}</span></td><td>{{.Guild}}</td><td>{{.Department}}</td><td>{{.ClosedAt}}</td><td>{{.Reason}}</td></tr>
+{{else}}<tr><td colspan="5" class="muted">No closed tickets{{if .Query}} match{{end}}.</td></tr>{{end}}
+</table>
+</body></html>`))
+
+var transcriptTemplate = template.Must(template.New("transcript").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Ticket {{.Row.Ticket.UserName}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; max-width: 60em; }
+.msg { padding: 8px 12px; margin: 8px 0; border-left: 4px solid #00BFFF; background: #f7fbff; }
+.staff { border-color: #FF8C00; background: #fffaf3; }
+.meta { color: #888; font-size: 0.9em; }
+pre { white-space: pre-wrap; font-family: inherit; margin: 4px 0 0; }
+</style></head><body>
+<p><a href="/dashboard">← Back</a></p>
+<h1>{{.Row.Ticket.UserName}} <span class="meta">{{.Row.Ticket.UserID}}</span></h1>
+<p>{{.Row.Guild}} · {{.Row.Department}} · {{.Row.Ticket.Status}}{{if .Row.ClaimedBy}} · claimed by {{.Row.ClaimedBy}}{{end}} · opened {{.Row.Ticket.OpenedAt.Format "2 Jan 2006 15:04 MST"}}{{if .Row.ClosedAt}} · closed {{.Row.ClosedAt}} ({{.Row.Reason}}){{end}}</p>
+{{range .Messages}}<div class="msg{{if .FromStaff}} staff{{end}}"><div class="meta">{{.Author}}{{if .FromStaff}} (staff){{end}} · {{.Time.Format "2 Jan 2006 15:04:05 MST"}}</div><pre>{{.Content}}</pre>{{range .Attachments}}<div><a href="{{.}}">{{.}}</a></div>{{end}}</div>
+{{else}}<p class="meta">No messages were relayed in this ticket.</p>{{end}}
+</body></html>`))
+
+// dashboardUser is the Basic auth user name, MODMAIL_DASHBOARD_USER or "admin".
+func dashboardUser() string {
+	if user := os.Getenv("MODMAIL_DASHBOARD_USER"); user != "" {
+		return user
+	}
+	return "admin"
+}
+
+// requireDashboardAuth wraps a handler with HTTP Basic authentication against the dashboard
+// credentials. Without a configured password the dashboard is not served at all.
+func requireDashboardAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		password := cfg.Secrets.DashboardPassword.reveal()
+		if password == "" {
+			http.NotFound(w, r)
+			return
+		}
+		user, pass, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(dashboardUser())) != 1 ||
+			subtle.ConstantTimeCompare([]byte(pass), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="ModMail", charset="UTF-8"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// registerDashboard adds the read-only web dashboard to the HTTP server.
+func registerDashboard(s *discordgo.Session) {
+	if cfg.Secrets.DashboardPassword == "" {
+		slog.Info("Web dashboard disabled; set MODMAIL_DASHBOARD_PASSWORD to enable it.")
+	}
+	http.HandleFunc("/dashboard", requireDashboardAuth(func(w http.ResponseWriter, r *http.Request) {
+		handleDashboard(s, w, r)
+	}))
+	http.HandleFunc("/dashboard/ticket", requireDashboardAuth(func(w http.ResponseWriter, r *http.Request) {
+		handleDashboardTicket(s, w, r)
+	}))
+}
+
+// handleDashboard lists open tickets and recently closed ones, optionally filtered by a search.
+func handleDashboard(s *discordgo.Session, w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+
+	var open []dashboardRow
+	for _, t := range activeTickets.all() {
+		if query != "" && !(transcript{Ticket: *t, Messages: openTicketMessages(t.ChannelID)}).matches(query) {
+			continue
+		}
+		open = append(open, newDashboardRow(s, *t))
+	}
+
+	transcripts, err := loadTranscripts()
+	if err != nil {
+		slog.Error("Error loading transcripts for dashboard", "err", err)
+	}
+	var closed []dashboardRow
+	for _, t := range transcripts {
+		if query != "" && !t.matches(query) {
+			continue
+		}
+		row := newDashboardRow(s, t.Ticket)
+		row.ClosedAt = t.ClosedAt.Format("2 Jan 2006 15:04 MST")
+		row.Reason = t.Reason
+		closed = append(closed, row)
+		if len(closed) == closedTicketsShown {
+			break
+		}
+	}
+
+	renderTemplate(w, dashboardTemplate, map[string]any{"Query": query, "Open": open, "Closed": closed})
+}
+
+// handleDashboardTicket renders one ticket's transcript, open or closed.
+func handleDashboardTicket(s *discordgo.Session, w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+
+	var row dashboardRow
+	var messages []transcriptMessage
+	if t, ok := activeTickets.forChannel(id); ok {
+		row = newDashboardRow(s, *t)
+		messages = openTicketMessages(id)
+	} else if t, err := loadTranscript(id); err == nil {
+		row = newDashboardRow(s, t.Ticket)
+		row.ClosedAt = t.ClosedAt.Format("2 Jan 2006 15:04 MST")
+		row.Reason = t.Reason
+		messages = t.Messages
+	} else {
+		http.NotFound(w, r)
+		return
+	}
+
+	renderTemplate(w, transcriptTemplate, map[string]any{"Row": row, "Messages": messages})
+}
+
+func newDashboardRow(s *discordgo.Session, t Ticket) dashboardRow {
+	row := dashboardRow{
+		Ticket:       t,
+		Guild:        guildName(s, t.GuildID),
+		Age:          formatAge(time.Since(t.OpenedAt)),
+		LastActivity: formatAge(time.Since(t.LastActivity)),
+	}
+	if gc := cfg.guild(t.GuildID); gc != nil {
+		row.Department = gc.department(t.Department).Name
+	}
+	if t.ClaimedBy != "" {
+		row.ClaimedBy = memberName(s, t.GuildID, t.ClaimedBy)
+	}
+	return row
+}
+
+// memberName returns a member's tag from the state cache, falling back to their ID.
+func memberName(s *discordgo.Session, guildID, userID string) string {
+	if m, err := s.State.Member(guildID, userID); err == nil && m.User != nil {
+		return m.User.String()
+	}
+	return userID
+}
+
+// formatAge renders a duration as a short human-readable age like "3h 12m".
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+	default:
+		return fmt.Sprintf("%dd %dh", int(d.Hours())/24, int(d.Hours())%24)
+	}
+}
+
+func renderTemplate(w http.ResponseWriter, tmpl *template.Template, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(w, data); err != nil {
+		slog.Error("Error rendering dashboard page", "template", tmpl.Name(), "err", err)
+	}
+}
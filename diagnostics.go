@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// checkResult is one line of the /modmail-setup checklist.
+type checkResult struct {
+	ok   bool
+	warn bool // Not a failure, but worth a look (e.g. no data yet)
+	text string
+	hint string // How to fix a failed check
+}
+
+func (r checkResult) String() string {
+	icon := "✅"
+	if !r.ok {
+		icon = "❌"
+	} else if r.warn {
+		icon = "⚠️"
+	}
+	line := icon + " " + r.text
+	if r.hint != "" && (!r.ok || r.warn) {
+		line += "\n  ↳ " + r.hint
+	}
+	return line
+}
+
+func checkPass(format string, args ...any) checkResult {
+	return checkResult{ok: true, text: fmt.Sprintf(format, args...)}
+}
+
+func checkFail(hint, format string, args ...any) checkResult {
+	return checkResult{text: fmt.Sprintf(format, args...), hint: hint}
+}
+
+func checkWarn(hint, format string, args ...any) checkResult {
+	return checkResult{ok: true, warn: true, text: fmt.Sprintf(format, args...), hint: hint}
+}
+
+// contentDelivery counts guild messages from users that could only carry content if the
+// MessageContent intent is enabled in the developer portal. DMs and messages mentioning the
+// bot always include content, so they are not counted.
+var contentDelivery struct {
+	sync.Mutex
+	seen        int
+	withContent int
+}
+
+// recordContentDelivery notes whether a guild message arrived with its content.
+func recordContentDelivery(s *discordgo.Session, m *discordgo.MessageCreate) {
+	if m.GuildID == "" || m.Author.Bot {
+		return
+	}
+	for _, u := range m.Mentions {
+		if u.ID == s.State.User.ID {
+			return
+		}
+	}
+
+	contentDelivery.Lock()
+	defer contentDelivery.Unlock()
+	contentDelivery.seen++
+	if m.Content != "" || len(m.Attachments) > 0 || len(m.Embeds) > 0 {
+		contentDelivery.withContent++
+	}
+}
+
+// runSetupChecks verifies a guild's ModMail configuration against what Discord reports.
+func runSetupChecks(s *discordgo.Session, guildID string) []checkResult {
+	gc := cfg.guild(guildID)
+	if !gc.isConfigured() {
+		return []checkResult{checkFail("Run `/modmail-setup wizard` or `/modmail-set-config` to choose a category, log channel and staff role.",
+			"ModMail is not configured in this server")}
+	}
+
+	var results []checkResult
+	botID := s.State.User.ID
+
+	switch gc.TicketMode {
+	case TicketModeForum, TicketModeThread:
+		parents := unique(gc.threadParentIDs())
+		if len(parents) == 0 {
+			results = append(results, checkFail("Set ThreadParentID in config.json.", "No ticket parent channel configured for %s mode", gc.TicketMode))
+		}
+		for _, parentID := range parents {
+			results = append(results, checkThreadParent(s, gc, parentID, botID)...)
+		}
+		if names := gc.departmentsSharingParent(); len(names) > 0 {
+			results = append(results, checkFail("Give each department with its own staff role a ThreadParentID of its own in config.json.",
+				"Departments %s would share the ticket parent channel with every other team", strings.Join(names, ", ")))
+		}
+	default:
+		for _, categoryID := range unique(gc.ticketCategoryIDs()) {
+			results = append(results, checkCategory(s, categoryID, botID)...)
+		}
+	}
+
+	logChannels := []string{gc.LogChannelID, gc.OpsChannelID}
+	staffRoles := []string{gc.StaffRoleID}
+	for _, d := range gc.Departments {
+		logChannels = append(logChannels, d.LogChannelID)
+		staffRoles = append(staffRoles, d.StaffRoleID)
+	}
+	for _, sr := range gc.StaffRoles {
+		staffRoles = append(staffRoles, sr.RoleID)
+	}
+
+	if gc.StaffRoleID == "" {
+		results = append(results, checkFail("Pick a staff role with `/modmail-set-config`.", "No staff role configured"))
+	}
+	if gc.LogChannelID == "" {
+		results = append(results, checkWarn("Set a log channel with `/modmail-set-config` to keep transcripts.", "No log channel configured"))
+	}
+	for _, channelID := range unique(logChannels) {
+		results = append(results, checkLogChannel(s, channelID, botID)...)
+	}
+	for _, roleID := range unique(staffRoles) {
+		results = append(results, checkRole(s, guildID, roleID))
+	}
+
+	return append(results, checkContentIntent())
+}
+
+func checkCategory(s *discordgo.Session, categoryID, botID string) []checkResult {
+	ch, err := fetchChannel(s, categoryID)
+	if err != nil {
+		return []checkResult{checkFail("The category was deleted or the bot can't see it. Pick another with `/modmail-set-config`.",
+			"Ticket category `%s` not found", categoryID)}
+	}
+	if ch.Type != discordgo.ChannelTypeGuildCategory {
+		return []checkResult{checkFail("Tickets must go into a category, not a regular channel.",
+			"<#%s> is not a category", categoryID)}
+	}
+
+	results := []checkResult{checkPass("Ticket category **%s** exists", ch.Name)}
+	return append(results, checkPermissions(s, botID, ch,
+		discordgo.PermissionViewChannel|discordgo.PermissionManageChannels|discordgo.PermissionManageRoles,
+		"Give the bot's role View Channel, Manage Channels and Manage Roles (Manage Permissions) on the category."))
+}
+
+func checkThreadParent(s *discordgo.Session, gc *GuildConfig, parentID, botID string) []checkResult {
+	ch, err := fetchChannel(s, parentID)
+	if err != nil {
+		return []checkResult{checkFail("The channel was deleted or the bot can't see it.", "Ticket parent channel `%s` not found", parentID)}
+	}
+
+	wantType, needed := discordgo.ChannelTypeGuildText, int64(discordgo.PermissionViewChannel|discordgo.PermissionCreatePrivateThreads|discordgo.PermissionSendMessagesInThreads|discordgo.PermissionManageThreads)
+	if gc.TicketMode == TicketModeForum {
+		wantType, needed = discordgo.ChannelTypeGuildForum, discordgo.PermissionViewChannel|discordgo.PermissionSendMessages|discordgo.PermissionSendMessagesInThreads|discordgo.PermissionManageThreads
+	}
+	if ch.Type != wantType {
+		return []checkResult{checkFail("Forum mode needs a forum channel; thread mode needs a text channel.", "<#%s> is the wrong channel type for %s mode", ch.ID, gc.TicketMode)}
+	}
+
+	results := []checkResult{checkPass("Ticket parent channel <#%s> exists", ch.ID)}
+	return append(results, checkPermissions(s, botID, ch, needed,
+		"Give the bot's role permission to create, post in and manage threads in that channel."))
+}
+
+func checkLogChannel(s *discordgo.Session, channelID, botID string) []checkResult {
+	if channelID == "" {
+		return nil
+	}
+	ch, err := fetchChannel(s, channelID)
+	if err != nil {
+		return []checkResult{checkFail("The channel was deleted or the bot can't see it. Pick another with `/modmail-set-config`.",
+			"Log channel `%s` not found", channelID)}
+	}
+	results := []checkResult{checkPass("Log channel <#%s> exists", ch.ID)}
+	return append(results, checkPermissions(s, botID, ch,
+		discordgo.PermissionViewChannel|discordgo.PermissionSendMessages|discordgo.PermissionEmbedLinks|discordgo.PermissionAttachFiles,
+		"Give the bot's role View Channel, Send Messages, Embed Links and Attach Files in the log channel."))
+}
+
+func checkRole(s *discordgo.Session, guildID, roleID string) checkResult {
+	role, err := s.State.Role(guildID, roleID)
+	if err != nil {
+		return checkFail("The role was deleted. Pick another with `/modmail-set-config`.", "Staff role `%s` not found", roleID)
+	}
+	return checkPass("Staff role **%s** exists", role.Name)
+}
+
+// checkPermissions reports which of the needed permissions the bot is missing in a channel.
+func checkPermissions(s *discordgo.Session, botID string, ch *discordgo.Channel, needed int64, hint string) checkResult {
+	perms, err := s.State.UserChannelPermissions(botID, ch.ID)
+	if err != nil {
+		return checkWarn("The bot's permissions could not be read from its cache; try again in a moment.", "Couldn't check permissions in **%s**", ch.Name)
+	}
+	if perms&discordgo.PermissionAdministrator != 0 {
+		return checkPass("Bot has all permissions in **%s** (Administrator)", ch.Name)
+	}
+	missing := needed &^ perms
+	if missing != 0 {
+		return checkFail(hint, "Bot is missing permissions in **%s**: %s", ch.Name, describePermissions(missing))
+	}
+	return checkPass("Bot has the permissions it needs in **%s**", ch.Name)
+}
+
+func checkContentIntent() checkResult {
+	contentDelivery.Lock()
+	defer contentDelivery.Unlock()
+
+	hint := "Enable **Message Content Intent** for the bot under Bot → Privileged Gateway Intents in the Discord developer portal."
+	switch {
+	case contentDelivery.seen == 0:
+		return checkWarn("Send a message in any channel the bot can see, then run this again.",
+			"Message Content intent not verified yet (no guild messages seen since startup)")
+	case contentDelivery.withContent == 0:
+		return checkFail(hint, "Message Content intent is not delivering content (%d messages seen, all empty)", contentDelivery.seen)
+	default:
+		return checkPass("Message Content intent is delivering content")
+	}
+}
+
+var describedPermissions = []struct {
+	bit  int64
+	name string
+}{
+	{discordgo.PermissionViewChannel, "View Channel"},
+	{discordgo.PermissionSendMessages, "Send Messages"},
+	{discordgo.PermissionEmbedLinks, "Embed Links"},
+	{discordgo.PermissionAttachFiles, "Attach Files"},
+	{discordgo.PermissionManageChannels, "Manage Channels"},
+	{discordgo.PermissionManageRoles, "Manage Roles"},
+	{discordgo.PermissionManageThreads, "Manage Threads"},
+	{discordgo.PermissionCreatePrivateThreads, "Create Private Threads"},
+	{discordgo.PermissionSendMessagesInThreads, "Send Messages in Threads"},
+}
+
+func describePermissions(perms int64) string {
+	var names []string
+	for _, p := range describedPermissions {
+		if perms&p.bit != 0 {
+			names = append(names, p.name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// unique drops empty and repeated IDs while keeping order.
+func unique(ids []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, id := range ids {
+		if id != "" && !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
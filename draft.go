@@ -0,0 +1,449 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// How long a user has to confirm a new ticket before their queued messages are discarded.
+const draftTimeout = 5 * time.Minute
+
+// Custom IDs for the buttons and select menus on the ticket confirmation prompt.
+const (
+	confirmTicketButtonID = "ticket-confirm"
+	cancelTicketButtonID  = "ticket-cancel"
+	guildSelectID         = "ticket-guild"
+	departmentSelectID    = "ticket-department"
+)
+
+// ticketDraft holds the messages a user sent before confirming that they want a ticket.
+type ticketDraft struct {
+	messages        []*discordgo.MessageCreate
+	promptChannelID string
+	promptMessageID string
+	timer           *time.Timer
+	guildIDs        []string // Configured guilds the user shares with the bot
+	guildID         string   // Selected guild, preset when only one is shared
+	department      string   // Selected department ID
+	departmentSet   bool
+}
+
+// Pending drafts keyed by user ID. The timeout callback runs on its own goroutine, so access is guarded.
+var (
+	pendingDrafts   = make(map[string]*ticketDraft)
+	pendingDraftsMu sync.Mutex
+)
+
+// queueDraftMessage stores a DM from a user without an open ticket. The first message
+// of a draft sends the confirmation prompt; later ones are simply queued behind it.
+func queueDraftMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
+	if appendDraftMessage(m) {
+		return
+	}
+
+	guildIDs := sharedGuilds(s, m.Author.ID)
+	if len(guildIDs) == 0 {
+		sendMessage(s, slog.With("user_id", m.Author.ID), m.ChannelID, "Sorry, I couldn't find a server we share where ModMail is set up.")
+		return
+	}
+
+	pendingDraftsMu.Lock()
+	if existing, ok := pendingDrafts[m.Author.ID]; ok {
+		// Another message started the draft while we were looking up guilds.
+		existing.messages = append(existing.messages, m)
+		pendingDraftsMu.Unlock()
+		return
+	}
+	draft := &ticketDraft{messages: []*discordgo.MessageCreate{m}, guildIDs: guildIDs}
+	if len(guildIDs) == 1 {
+		draft.guildID = guildIDs[0]
+	}
+	pendingDrafts[m.Author.ID] = draft
+	embed, components := draft.prompt(s)
+	pendingDraftsMu.Unlock()
+
+	prompt, err := s.ChannelMessageSendComplex(m.ChannelID, &discordgo.MessageSend{
+		Embeds:     []*discordgo.MessageEmbed{embed},
+		Components: components,
+	})
+	if err != nil {
+		slog.Error("Error sending ticket confirmation prompt", "user_id", m.Author.ID, "channel_id", m.ChannelID, "err", err)
+		takeDraft(m.Author.ID)
+		return
+	}
+
+	pendingDraftsMu.Lock()
+	draft.promptChannelID = prompt.ChannelID
+	draft.promptMessageID = prompt.ID
+	userID := m.Author.ID
+	draft.timer = time.AfterFunc(draftTimeout, func() { expireDraft(s, userID, draft) })
+	pendingDraftsMu.Unlock()
+}
+
+// appendDraftMessage queues a message behind an existing draft, reporting whether one existed.
+func appendDraftMessage(m *discordgo.MessageCreate) bool {
+	pendingDraftsMu.Lock()
+	defer pendingDraftsMu.Unlock()
+
+	draft, ok := pendingDrafts[m.Author.ID]
+	if ok {
+		draft.messages = append(draft.messages, m)
+	}
+	return ok
+}
+
+// sharedGuilds lists the configured guilds the user is a member of, ordered by name.
+func sharedGuilds(s *discordgo.Session, userID string) []string {
+	var guildIDs []string
+	for guildID, gc := range cfg.guilds() {
+		if !gc.isConfigured() {
+			continue
+		}
+		if _, err := s.State.Member(guildID, userID); err != nil {
+			if _, err := s.GuildMember(guildID, userID); err != nil {
+				slog.Debug("User is not a member of configured guild", "user_id", userID, "guild_id", guildID, "err", err)
+				continue
+			}
+		}
+		guildIDs = append(guildIDs, guildID)
+	}
+	sort.Slice(guildIDs, func(a, b int) bool {
+		return guildName(s, guildIDs[a]) < guildName(s, guildIDs[b])
+	})
+	return guildIDs
+}
+
+// guildName returns the cached name of a guild, falling back to its ID.
+func guildName(s *discordgo.Session, guildID string) string {
+	if g, err := s.State.Guild(guildID); err == nil && g.Name != "" {
+		return g.Name
+	}
+	return guildID
+}
+
+// takeDraft removes and returns the pending draft for a user, stopping its timeout.
+func takeDraft(userID string) *ticketDraft {
+	pendingDraftsMu.Lock()
+	defer pendingDraftsMu.Unlock()
+
+	draft, ok := pendingDrafts[userID]
+	if !ok {
+		return nil
+	}
+	delete(pendingDrafts, userID)
+	if draft.timer != nil {
+		draft.timer.Stop()
+	}
+	return draft
+}
+
+// restoreDraft puts back a draft whose ticket could not be opened and shows its prompt
+// again, so the user can retry without resending their messages. If a new message started
+// another draft in the meantime, the restored messages are queued ahead of it instead.
+func restoreDraft(s *discordgo.Session, userID string, draft *ticketDraft) {
+	pendingDraftsMu.Lock()
+	if newer, ok := pendingDrafts[userID]; ok {
+		newer.messages = append(draft.messages, newer.messages...)
+		pendingDraftsMu.Unlock()
+		return
+	}
+	pendingDrafts[userID] = draft
+	draft.timer = time.AfterFunc(draftTimeout, func() { expireDraft(s, userID, draft) })
+	embed, components := draft.prompt(s)
+	pendingDraftsMu.Unlock()
+
+	embeds := []*discordgo.MessageEmbed{embed}
+	_, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:         draft.promptMessageID,
+		Channel:    draft.promptChannelID,
+		Embeds:     &embeds,
+		Components: &components,
+	})
+	if err != nil {
+		slog.Error("Error restoring ticket prompt", "user_id", userID, "channel_id", draft.promptChannelID, "err", err)
+	}
+}
+
+// expireDraft discards a draft that was never confirmed and disables its prompt.
+func expireDraft(s *discordgo.Session, userID string, draft *ticketDraft) {
+	defer recoverPanic(slog.With("user_id", userID), "draft timeout")
+	pendingDraftsMu.Lock()
+	if pendingDrafts[userID] != draft {
+		// Already confirmed or cancelled.
+		pendingDraftsMu.Unlock()
+		return
+	}
+	delete(pendingDrafts, userID)
+	pendingDraftsMu.Unlock()
+
+	embeds := []*discordgo.MessageEmbed{{
+		Title:       "⌛ Ticket Request Expired",
+		Description: "No ticket was opened and your message was discarded. Send a new message if you still need help.",
+		Color:       0x808080, // Grey
+	}}
+	components := []discordgo.MessageComponent{}
+	_, err := s.ChannelMessageEditComplex(&discordgo.MessageEdit{
+		ID:         draft.promptMessageID,
+		Channel:    draft.promptChannelID,
+		Embeds:     &embeds,
+		Components: &components,
+	})
+	if err != nil {
+		slog.Error("Error updating expired ticket prompt", "user_id", userID, "channel_id", draft.promptChannelID, "err", err)
+	}
+}
+
+// prompt builds the confirmation prompt for the draft's current selections, including a
+// server picker when the user shares several configured guilds and a department picker
+// when the selected guild has departments. Callers must hold pendingDraftsMu.
+func (d *ticketDraft) prompt(s *discordgo.Session) (*discordgo.MessageEmbed, []discordgo.MessageComponent) {
+	embed := &discordgo.MessageEmbed{
+		Title:       "📨 Open a Support Ticket?",
+		Description: "Your message will be sent to the staff team once you confirm. Anything else you send before confirming will be included too.",
+		Color:       0x00BFFF, // Deep Sky Blue
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: "This request expires in " + draftTimeout.String() + ".",
+		},
+	}
+	var rows []discordgo.MessageComponent
+
+	if len(d.guildIDs) > 1 {
+		embed.Description += "\n\nPlease choose the server whose staff you want to contact."
+		options := make([]discordgo.SelectMenuOption, 0, len(d.guildIDs))
+		for _, guildID := range d.guildIDs {
+			options = append(options, discordgo.SelectMenuOption{
+				Label:   guildName(s, guildID),
+				Value:   guildID,
+				Default: guildID == d.guildID,
+			})
+		}
+		rows = append(rows, selectMenuRow(guildSelectID, "Choose a server", options))
+	}
+	if d.guildID != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   "Server",
+			Value:  guildName(s, d.guildID),
+			Inline: true,
+		})
+	}
+
+	if gc := cfg.guild(d.guildID); gc != nil && len(gc.Departments) > 0 {
+		embed.Description += "\n\nPlease choose the team you want to contact below."
+		options := make([]discordgo.SelectMenuOption, 0, len(gc.Departments))
+		for _, dept := range gc.Departments {
+			options = append(options, discordgo.SelectMenuOption{
+				Label:       dept.Name,
+				Value:       dept.ID,
+				Description: dept.Description,
+				Default:     d.departmentSet && dept.ID == d.department,
+			})
+		}
+		rows = append(rows, selectMenuRow(departmentSelectID, "Choose a department", options))
+		if d.departmentSet {
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+				Name:   "Department",
+				Value:  gc.department(d.department).Name,
+				Inline: true,
+			})
+		}
+	}
+
+	rows = append(rows, discordgo.ActionsRow{
+		Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "Confirm",
+				Style:    discordgo.SuccessButton,
+				CustomID: confirmTicketButtonID,
+			},
+			discordgo.Button{
+				Label:    "Cancel",
+				Style:    discordgo.SecondaryButton,
+				CustomID: cancelTicketButtonID,
+			},
+		},
+	})
+	return embed, rows
+}
+
+// missingSelection describes what the user still has to pick before confirming, if anything.
+// Callers must hold pendingDraftsMu.
+func (d *ticketDraft) missingSelection() string {
+	if d.guildID == "" {
+		return "server"
+	}
+	if gc := cfg.guild(d.guildID); gc != nil && len(gc.Departments) > 0 && !d.departmentSet {
+		return "department"
+	}
+	return ""
+}
+
+func selectMenuRow(customID, placeholder string, options []discordgo.SelectMenuOption) discordgo.ActionsRow {
+	return discordgo.ActionsRow{
+		Components: []discordgo.MessageComponent{
+			discordgo.SelectMenu{
+				MenuType:    discordgo.StringSelectMenu,
+				CustomID:    customID,
+				Placeholder: placeholder,
+				Options:     options,
+			},
+		},
+	}
+}
+
+// handleGuildSelect records the server chosen on a pending prompt. Changing the server
+// clears any department picked for the previous one.
+func handleGuildSelect(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	updateDraftSelection(s, i, func(d *ticketDraft, value string) {
+		if d.guildID != value {
+			d.department = ""
+			d.departmentSet = false
+		}
+		d.guildID = value
+	})
+}
+
+// handleDepartmentSelect records the department chosen on a pending prompt.
+func handleDepartmentSelect(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	updateDraftSelection(s, i, func(d *ticketDraft, value string) {
+		d.department = value
+		d.departmentSet = true
+	})
+}
+
+// updateDraftSelection applies a select menu choice to the user's draft and redraws the prompt.
+func updateDraftSelection(s *discordgo.Session, i *discordgo.InteractionCreate, apply func(d *ticketDraft, value string)) {
+	user := interactionUser(i)
+	values := i.MessageComponentData().Values
+	if len(values) == 0 {
+		return
+	}
+
+	pendingDraftsMu.Lock()
+	draft, ok := pendingDrafts[user.ID]
+	var embed *discordgo.MessageEmbed
+	var components []discordgo.MessageComponent
+	if ok {
+		apply(draft, values[0])
+		embed, components = draft.prompt(s)
+	}
+	pendingDraftsMu.Unlock()
+
+	if !ok {
+		updatePrompt(s, i, expiredPromptEmbed())
+		return
+	}
+
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
+		},
+	})
+	if err != nil {
+		interactionLog(i).Error("Error updating ticket prompt", "err", err)
+	}
+}
+
+func expiredPromptEmbed() *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Title:       "⌛ Ticket Request Expired",
+		Description: "This request is no longer pending. Send a new message if you still need help.",
+		Color:       0x808080, // Grey
+	}
+}
+
+// handleConfirmTicket opens the ticket for a confirmed draft and relays the queued messages.
+func handleConfirmTicket(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	user := interactionUser(i)
+
+	pendingDraftsMu.Lock()
+	var missing string
+	if draft, ok := pendingDrafts[user.ID]; ok {
+		missing = draft.missingSelection()
+	}
+	pendingDraftsMu.Unlock()
+
+	if missing != "" {
+		respond(s, i, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Content: fmt.Sprintf("Please choose a %s before confirming.", missing),
+				Flags:   discordgo.MessageFlagsEphemeral,
+			},
+		})
+		return
+	}
+
+	draft := takeDraft(user.ID)
+	if draft == nil || cfg.guild(draft.guildID) == nil {
+		updatePrompt(s, i, expiredPromptEmbed())
+		return
+	}
+	dept := cfg.guild(draft.guildID).department(draft.department)
+
+	updatePrompt(s, i, &discordgo.MessageEmbed{
+		Title:       "📨 Opening Ticket...",
+		Description: "Please wait while your ticket is created.",
+		Color:       0x00BFFF, // Deep Sky Blue
+	})
+
+	// A ticket staff opened with /contact in the meantime takes the queued messages instead.
+	ticket, err := createNewTicket(s, draft.guildID, user, dept, nil)
+	if err != nil && !(errors.Is(err, errTicketExists) && ticket != nil) {
+		logger := slog.With("guild_id", draft.guildID, "user_id", user.ID, "channel_id", i.ChannelID)
+		restoreDraft(s, user.ID, draft)
+		if errors.Is(err, errTicketExists) {
+			sendMessage(s, logger, i.ChannelID, "A ticket is already being opened for you. Press Confirm again in a moment to add your messages to it.")
+			return
+		}
+		logger.Error("Error creating ticket", "err", err)
+		sendMessage(s, logger, i.ChannelID, "Sorry, I couldn't create a support ticket. Staff configuration may be incomplete. "+
+			"Your messages have been kept, so you can press Confirm to try again.")
+		return
+	}
+
+	for _, m := range draft.messages {
+		forwardUserMessage(s, m, ticket)
+	}
+
+	sendMessage(s, ticketLog(ticket), i.ChannelID, dept.Greeting)
+}
+
+// handleCancelTicket discards a draft without opening a ticket.
+func handleCancelTicket(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	takeDraft(interactionUser(i).ID)
+	updatePrompt(s, i, &discordgo.MessageEmbed{
+		Title:       "❎ Ticket Request Cancelled",
+		Description: "No ticket was opened and your message was discarded.",
+		Color:       0x808080, // Grey
+	})
+}
+
+// updatePrompt replaces the confirmation prompt with a status embed and removes its buttons.
+func updatePrompt(s *discordgo.Session, i *discordgo.InteractionCreate, embed *discordgo.MessageEmbed) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+	if err != nil {
+		interactionLog(i).Error("Error updating ticket prompt", "err", err)
+	}
+}
+
+// interactionUser returns the invoking user for both guild and DM interactions.
+func interactionUser(i *discordgo.InteractionCreate) *discordgo.User {
+	if i.Member != nil {
+		return i.Member.User
+	}
+	return i.User
+}
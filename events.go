@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// TicketEvent is something that happened to a ticket. Ticket code publishes events and
+// side effects (transcripts, metrics, the log channel, webhooks) subscribe to them, so a new
+// integration only needs a subscriber. Subscribers switch on the concrete type.
+type TicketEvent interface {
+	ticket() Ticket
+}
+
+// TicketOpened is published once a ticket's channel or thread exists and it is registered.
+type TicketOpened struct {
+	Ticket   Ticket
+	User     *discordgo.User
+	OpenedBy *discordgo.User // Staff member for tickets opened with /contact, nil if the user opened it
+}
+
+// MessageRelayed is published after a message reached the other side of a ticket.
+type MessageRelayed struct {
+	Ticket  Ticket
+	Message transcriptMessage
+}
+
+// TicketClaimed is published when a staff member claims a ticket.
+type TicketClaimed struct {
+	Ticket Ticket
+	By     *discordgo.User
+}
+
+// TicketClosed is published after a ticket is closed or deleted and removed from the
+// active tickets.
+type TicketClosed struct {
+	Ticket  Ticket
+	User    *discordgo.User // The ticket's user
+	By      *discordgo.User // Staff member who closed it
+	Reason  string
+	Deleted bool // The ticket channel is being deleted rather than kept
+}
+
+func (e TicketOpened) ticket() Ticket   { return e.Ticket }
+func (e MessageRelayed) ticket() Ticket { return e.Ticket }
+func (e TicketClaimed) ticket() Ticket  { return e.Ticket }
+func (e TicketClosed) ticket() Ticket   { return e.Ticket }
+
+type ticketSubscriber func(s *discordgo.Session, e TicketEvent)
+
+// ticketEvents holds the subscribers, called in subscription order.
+var ticketEvents struct {
+	sync.RWMutex
+	subscribers []ticketSubscriber
+}
+
+// subscribe registers fn to be called for every ticket event.
+func subscribe(fn ticketSubscriber) {
+	ticketEvents.Lock()
+	defer ticketEvents.Unlock()
+	ticketEvents.subscribers = append(ticketEvents.subscribers, fn)
+}
+
+// publish hands an event to every subscriber in turn before returning, so the publisher's
+// next step sees their effects. A panicking subscriber is logged and skipped without
+// affecting the others. Slow work belongs in a goroutine inside the subscriber.
+func publish(s *discordgo.Session, e TicketEvent) {
+	ticketEvents.RLock()
+	subscribers := ticketEvents.subscribers
+	ticketEvents.RUnlock()
+	for _, fn := range subscribers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t := e.ticket()
+					ticketLog(&t).Error("Ticket event subscriber panicked", "event", fmt.Sprintf("%T", e), "panic", r, "stack", string(debug.Stack()))
+				}
+			}()
+			fn(s, e)
+		}()
+	}
+}
+
+// subscribeTicketEvents wires the built-in integrations to the event bus. Transcripts come
+// first so later subscribers see a message's effect on the ticket.
+func subscribeTicketEvents() {
+	subscribe(recordTranscriptEvent)
+	subscribe(recordTicketMetrics)
+	subscribe(postTicketLog)
+	subscribe(sendTicketWebhooks)
+	subscribe(auditTicketEvent)
+}
@@ -3,5 +3,12 @@ module github.com/yourusername/modmail-bot // Replace 'yourusername'
 go 1.21
 
 require (
-    github.com/bwmarrin/discordgo v0.28.1
+	github.com/BurntSushi/toml v1.6.0
+	github.com/bwmarrin/discordgo v0.28.1
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/gorilla/websocket v1.4.2 // indirect
+	golang.org/x/crypto v0.0.0-20210421170649-83a5a9bb288b // indirect
 )
@@ -1,8 +1,8 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"log/slog"
+	"strings"
 
 	"github.com/bwmarrin/discordgo"
 )
@@ -10,96 +10,96 @@ import (
 // handleMessageCreate routes incoming messages either from a user DM or a staff reply.
 func handleMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
 	// Ignore bot messages or if config is not set up
-	if m.Author.ID == s.State.User.ID || cfg.ModMailCategoryID == "" {
+	if m.Author.ID == s.State.User.ID || len(cfg.guilds()) == 0 {
 		return
 	}
+	defer recoverPanic(slog.With("guild_id", m.GuildID, "channel_id", m.ChannelID, "user_id", m.Author.ID), "message")
 
-    // FIX 1: Channel fetch with API fallback (required for DMs not in state cache)
-	channel, err := s.State.Channel(m.ChannelID)
+	recordContentDelivery(s, m)
+
+	// FIX 1: Channel fetch with API fallback (required for DMs not in state cache)
+	channel, err := fetchChannel(s, m.ChannelID)
 	if err != nil {
-		// Attempt to fetch channel directly from Discord API
-        channel, err = s.Channel(m.ChannelID)
-        if err != nil {
-            log.Printf("Error fetching channel %s: %v", m.ChannelID, err)
-            // If we can't get channel info, we can't process the message, so we return.
-            return
-        }
+		slog.Error("Error fetching channel", "channel_id", m.ChannelID, "user_id", m.Author.ID, "err", err)
+		// If we can't get channel info, we can't process the message, so we return.
+		return
 	}
 
 	// --- CASE 1: Incoming User DM ---
 	if channel.Type == discordgo.ChannelTypeDM {
-		ticketChannelID, ok := activeTickets[m.Author.ID]
+		ticket, ok := activeTickets.forUser(m.Author.ID)
 		if ok {
-			forwardUserMessage(s, m, ticketChannelID)
+			forwardUserMessage(s, m, ticket)
 		} else {
-			// No active ticket, create a new one.
-			newChannelID, err := createNewTicket(s, m.Author)
-			if err != nil {
-				s.ChannelMessageSend(m.ChannelID, "Sorry, I couldn't create a support ticket. Staff configuration may be incomplete.")
-				log.Printf("Error creating new ticket for user %s: %v", m.Author.ID, err)
-				return
-			}
-			activeTickets[m.Author.ID] = newChannelID
-			forwardUserMessage(s, m, newChannelID)
-			
-			s.ChannelMessageSend(m.ChannelID, fmt.Sprintf(
-				"Thank you! A new support ticket has been opened. A staff member will respond shortly.",
-			))
+			// No active ticket, ask the user to confirm before creating one.
+			queueDraftMessage(s, m)
 		}
 		return
 	}
 
 	// --- CASE 2: Staff Reply in a Ticket Channel ---
-	if channel.Type == discordgo.ChannelTypeGuildText && channel.ParentID == cfg.ModMailCategoryID {
-		// Find the user ID linked to this ticket channel
-		var userID string
-		for uid, cid := range activeTickets {
-			if cid == m.ChannelID {
-				userID = uid
-				break
-			}
-		}
+	gc := cfg.guild(m.GuildID)
+	if gc.isTicketChannel(channel) {
+		// Find the ticket linked to this channel
+		ticket, ok := activeTickets.forChannel(m.ChannelID)
 
-		if userID != "" {
+		if ok {
             // FIX 2: Member fetch with API fallback (required if member data is not cached)
-			member, err := s.State.Member(cfg.GuildID, m.Author.ID)
+			member, err := s.State.Member(m.GuildID, m.Author.ID)
 			if err != nil {
                 // Member not in state cache, fetch directly from API
-                member, err = s.GuildMember(cfg.GuildID, m.Author.ID)
+                member, err = s.GuildMember(m.GuildID, m.Author.ID)
                 if err != nil {
-				    log.Printf("Error fetching member %s: %v", m.Author.ID, err)
+				    ticketLog(ticket).Error("Error fetching member", "channel_id", m.ChannelID, "member_id", m.Author.ID, "err", err)
 				    return
                 }
 			}
 
-			if isStaff(member) {
-				forwardStaffReply(s, m, userID)
+			if isStaff(member, gc, gc.department(ticket.Department)) {
+				forwardStaffReply(s, m, ticket)
 			}
 		}
 	}
 }
 
-// Check if a member has the required staff role.
-func isStaff(member *discordgo.Member) bool {
-    if cfg.StaffRoleID == "" {
-        return false
-    }
-	for _, roleID := range member.Roles {
-		if roleID == cfg.StaffRoleID {
-			return true
-		}
+// fetchChannel looks a channel up in the state cache, falling back to the API for channels
+// that are not cached (DMs, and threads created before a restart).
+func fetchChannel(s *discordgo.Session, channelID string) (*discordgo.Channel, error) {
+	channel, err := s.State.Channel(channelID)
+	if err != nil {
+		channel, err = s.Channel(channelID)
 	}
-	return false
+	return channel, err
+}
+
+// Check if a member is at least a helper for the given department. The guild's staff role
+// counts for every department.
+func isStaff(member *discordgo.Member, gc *GuildConfig, dept Department) bool {
+	return memberLevel(member, gc, dept) >= LevelHelper
 }
 
-// handleInteractionCreate handles all slash command interactions.
+// handleInteractionCreate handles all slash command, autocomplete and message component interactions.
 func handleInteractionCreate(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	defer recoverPanic(interactionLog(i), "interaction")
 	if i.Type == discordgo.InteractionApplicationCommand {
+		if !authorizeCommand(s, i) {
+			return
+		}
 		switch i.ApplicationCommandData().Name {
 		case "modmail-setup":
 			handleSetupCommand(s, i)
 		case "modmail-set-config":
 			handleSetConfigCommand(s, i)
+		case "modmail-config":
+			handleConfigCommand(s, i)
+		case "modmail-commands":
+			handleCommandsReportCommand(s, i)
+		case "modmail-webhooks":
+			handleWebhooksCommand(s, i)
+		case "audit":
+			handleAuditCommand(s, i)
+		case "contact":
+			handleContactCommand(s, i)
 		case "claim":
 			handleClaimCommand(s, i)
 		case "close":
@@ -108,4 +108,31 @@ func handleInteractionCreate(s *discordgo.Session, i *discordgo.InteractionCreat
 			handleDeleteCommand(s, i)
 		}
 	}
+
+	if i.Type == discordgo.InteractionApplicationCommandAutocomplete {
+		switch i.ApplicationCommandData().Name {
+		case "contact":
+			handleDepartmentAutocomplete(s, i)
+		case "modmail-config":
+			handleConfigAutocomplete(s, i)
+		}
+	}
+
+	if i.Type == discordgo.InteractionMessageComponent {
+		customID := i.MessageComponentData().CustomID
+		if strings.HasPrefix(customID, "wizard-") {
+			handleWizardComponent(s, i)
+			return
+		}
+		switch customID {
+		case confirmTicketButtonID:
+			handleConfirmTicket(s, i)
+		case cancelTicketButtonID:
+			handleCancelTicket(s, i)
+		case guildSelectID:
+			handleGuildSelect(s, i)
+		case departmentSelectID:
+			handleDepartmentSelect(s, i)
+		}
+	}
 }
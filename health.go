@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// storePingTimeout is how long /readyz waits for the ticket store before calling it stuck.
+const storePingTimeout = 2 * time.Second
+
+// gatewayConnected tracks whether the gateway session is up, from Ready/Resumed and
+// Disconnect events.
+var gatewayConnected atomic.Bool
+
+var startedAt = time.Now()
+
+// trackGatewayState keeps gatewayConnected in sync with the session.
+func trackGatewayState(dg *discordgo.Session) {
+	dg.AddHandler(func(s *discordgo.Session, _ *discordgo.Ready) { gatewayConnected.Store(true) })
+	dg.AddHandler(func(s *discordgo.Session, _ *discordgo.Resumed) { gatewayConnected.Store(true) })
+	dg.AddHandler(func(s *discordgo.Session, _ *discordgo.Disconnect) { gatewayConnected.Store(false) })
+}
+
+// handleHealthz reports that the process is alive and serving HTTP.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":         "ok",
+		"uptime_seconds": int(time.Since(startedAt).Seconds()),
+	})
+}
+
+// readiness is the /readyz response body.
+type readiness struct {
+	Ready              bool     `json:"ready"`
+	GatewayConnected   bool     `json:"gateway_connected"`
+	HeartbeatLatencyMS int64    `json:"heartbeat_latency_ms"`
+	ConfiguredGuilds   []string `json:"configured_guilds"`
+	UnconfiguredGuilds []string `json:"unconfigured_guilds"`
+	TicketStoreOK      bool     `json:"ticket_store_ok"`
+	OpenTickets        int      `json:"open_tickets"`
+	Problems           []string `json:"problems,omitempty"` // Reasons the bot is not ready
+	Warnings           []string `json:"warnings,omitempty"` // Worth knowing, but not a reason to restart
+}
+
+// readyzHandler reports whether the bot can actually handle tickets: the gateway is
+// connected and the ticket store responds. It answers 503 otherwise, so the host restarts or
+// stops routing to a broken bot. Guilds without ModMail set up are only listed, since a
+// fresh install has to stay up long enough for someone to run /modmail-setup.
+func readyzHandler(dg *discordgo.Session) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := readiness{
+			GatewayConnected:   gatewayConnected.Load(),
+			ConfiguredGuilds:   []string{},
+			UnconfiguredGuilds: []string{},
+		}
+		if report.GatewayConnected {
+			report.HeartbeatLatencyMS = dg.HeartbeatLatency().Milliseconds()
+		} else {
+			report.Problems = append(report.Problems, "gateway disconnected")
+		}
+
+		for guildID, gc := range cfg.guilds() {
+			if gc.isConfigured() {
+				report.ConfiguredGuilds = append(report.ConfiguredGuilds, guildID)
+			} else {
+				report.UnconfiguredGuilds = append(report.UnconfiguredGuilds, guildID)
+			}
+		}
+		sort.Strings(report.ConfiguredGuilds)
+		sort.Strings(report.UnconfiguredGuilds)
+		if len(report.ConfiguredGuilds) == 0 {
+			report.Warnings = append(report.Warnings, "no guild has ModMail configured")
+		}
+
+		report.OpenTickets, report.TicketStoreOK = activeTickets.ping(storePingTimeout)
+		if !report.TicketStoreOK {
+			report.Problems = append(report.Problems, "ticket store did not respond")
+		}
+
+		report.Ready = len(report.Problems) == 0
+		status := http.StatusOK
+		if !report.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, report)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// historyPageSize is how many revisions /modmail-config history shows.
+const historyPageSize = 10
+
+// configRevision is a snapshot of one guild's settings after a change.
+type configRevision struct {
+	Revision int // Per-guild, starting at 1
+	GuildID  string
+	Time     time.Time
+	AuthorID string `json:",omitempty"` // Empty for changes made by the bot or by editing the file
+	Author   string
+	Source   string          // What made the change, e.g. "/modmail-set-config"
+	Settings json.RawMessage // The guild's GuildConfig after the change
+}
+
+// configHistory holds every revision from the history file, which is appended to as a
+// JSON line per revision. It is loaded by initConfigHistory.
+var configHistory struct {
+	sync.Mutex
+	revisions []configRevision
+}
+
+// historyFileName keeps the history next to the config file.
+func historyFileName() string {
+	return filepath.Join(filepath.Dir(configFileName), "config-history.jsonl")
+}
+
+// initConfigHistory loads the history file and records the current settings of any guild
+// without history yet, so its first change can be rolled back.
+func initConfigHistory() {
+	configHistory.Lock()
+	f, err := os.Open(historyFileName())
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			var rev configRevision
+			if err := json.Unmarshal(scanner.Bytes(), &rev); err != nil {
+				slog.Warn("Skipping malformed config history entry", "file", historyFileName(), "err", err)
+				continue
+			}
+			configHistory.revisions = append(configHistory.revisions, rev)
+		}
+		if err := scanner.Err(); err != nil {
+			slog.Error("Error reading config history", "file", historyFileName(), "err", err)
+		}
+		f.Close()
+	} else if !os.IsNotExist(err) {
+		slog.Error("Error opening config history", "file", historyFileName(), "err", err)
+	}
+	configHistory.Unlock()
+
+	for guildID := range cfg.guilds() {
+		if len(guildRevisions(guildID)) == 0 {
+			recordConfigRevision(guildID, nil, "Settings at first startup with history")
+		}
+	}
+}
+
+// saveGuildConfig saves the configuration after a change to one guild's settings, records
+// the new settings as a revision and audits changes made by staff. before is the guild's
+// settings from just before the change, nil if it had none.
+func saveGuildConfig(s *discordgo.Session, guildID string, before *GuildConfig, author *discordgo.User, source string) {
+	if before == nil {
+		before = &GuildConfig{}
+	}
+	old, _ := json.Marshal(before)
+
+	cfg.SaveConfig()
+	rev, ok := recordConfigRevision(guildID, author, source)
+	if ok {
+		actor := author
+		if actor == nil {
+			actor = botActor(s)
+		}
+		audit(s, auditEntry{GuildID: guildID, Action: auditConfigChange, ActorID: actor.ID, Actor: actor.String(), Params: map[string]string{
+			"source":   source,
+			"revision": fmt.Sprint(rev.Revision),
+			"changes":  strings.Join(settingsChanges(old, rev.Settings), "; "),
+		}})
+	}
+}
+
+// recordConfigRevision appends the guild's current settings to the history and returns the
+// new revision. author may be nil for changes the bot made on its own.
+func recordConfigRevision(guildID string, author *discordgo.User, source string) (configRevision, bool) {
+	gc := cfg.guild(guildID)
+	if gc == nil {
+		return configRevision{}, false
+	}
+	settings, err := json.Marshal(gc)
+	if err != nil {
+		slog.Error("Error snapshotting config", "guild_id", guildID, "err", err)
+		return configRevision{}, false
+	}
+
+	rev := configRevision{GuildID: guildID, Time: time.Now().UTC(), Author: "ModMail", Source: source, Settings: settings}
+	if author != nil {
+		rev.AuthorID, rev.Author = author.ID, author.String()
+	}
+
+	configHistory.Lock()
+	defer configHistory.Unlock()
+	for _, r := range configHistory.revisions {
+		if r.GuildID == guildID {
+			rev.Revision = max(rev.Revision, r.Revision)
+		}
+	}
+	rev.Revision++
+
+	line, err := json.Marshal(rev)
+	if err != nil {
+		slog.Error("Error marshalling config revision", "guild_id", guildID, "err", err)
+		return configRevision{}, false
+	}
+	f, err := os.OpenFile(historyFileName(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		slog.Error("Error opening config history", "file", historyFileName(), "err", err)
+		return configRevision{}, false
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		slog.Error("Error writing config history", "file", historyFileName(), "err", err)
+		return configRevision{}, false
+	}
+	configHistory.revisions = append(configHistory.revisions, rev)
+	return rev, true
+}
+
+// guildRevisions returns a guild's revisions, oldest first.
+func guildRevisions(guildID string) []configRevision {
+	configHistory.Lock()
+	defer configHistory.Unlock()
+	var out []configRevision
+	for _, r := range configHistory.revisions {
+		if r.GuildID == guildID {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// recordReloadRevisions records a revision for every guild whose settings a reload changed.
+func recordReloadRevisions(before map[string]*GuildConfig, trigger string) {
+	for guildID, gc := range cfg.guilds() {
+		if !bytes.Equal(marshalGuild(before[guildID]), marshalGuild(gc)) {
+			recordConfigRevision(guildID, nil, fmt.Sprintf("%s edited (%s)", configFileName, trigger))
+		}
+	}
+}
+
+func marshalGuild(gc *GuildConfig) []byte {
+	if gc == nil {
+		return nil
+	}
+	data, _ := json.Marshal(gc)
+	return data
+}
+
+// handleConfigHistoryCommand lists the guild's most recent revisions with what each changed.
+func handleConfigHistoryCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	revisions := guildRevisions(i.GuildID)
+	if len(revisions) == 0 {
+		respondEphemeral(s, i, "No configuration changes have been recorded in this server yet.")
+		return
+	}
+
+	var b strings.Builder
+	start := max(len(revisions)-historyPageSize, 0)
+	for n := len(revisions) - 1; n >= start; n-- {
+		rev := revisions[n]
+		fmt.Fprintf(&b, "**#%d** <t:%d:f> by %s — %s\n", rev.Revision, rev.Time.Unix(), rev.Author, rev.Source)
+		if n > 0 {
+			for _, change := range settingsChanges(revisions[n-1].Settings, rev.Settings) {
+				b.WriteString("  ↳ " + change + "\n")
+			}
+		}
+	}
+
+	respond(s, i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{{
+				Title:       "📜 Configuration History",
+				Description: truncate(b.String(), 4096),
+				Footer:      &discordgo.MessageEmbedFooter{Text: "Restore a revision with /modmail-config rollback"},
+				Color:       0x00BFFF, // Deep Sky Blue
+			}},
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
+
+// settingsChanges describes the fields that differ between two snapshots.
+func settingsChanges(before, after json.RawMessage) []string {
+	var old, cur map[string]json.RawMessage
+	json.Unmarshal(before, &old)
+	json.Unmarshal(after, &cur)
+
+	var fields []string
+	for field := range cur {
+		if !bytes.Equal(old[field], cur[field]) {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := make([]string, 0, len(fields))
+	for _, field := range fields {
+		changes = append(changes, fmt.Sprintf("%s: %s → %s", field, truncate(string(old[field]), 60), truncate(string(cur[field]), 60)))
+	}
+	return changes
+}
+
+// handleConfigRollbackCommand restores a guild's settings from an earlier revision. The
+// rollback is itself recorded as a new revision, so it can be undone.
+func handleConfigRollbackCommand(s *discordgo.Session, i *discordgo.InteractionCreate, revision int) {
+	var target *configRevision
+	for _, rev := range guildRevisions(i.GuildID) {
+		if rev.Revision == revision {
+			target = &rev
+			break
+		}
+	}
+	if target == nil {
+		respondEphemeral(s, i, fmt.Sprintf("❌ There is no revision #%d. Use `/modmail-config history` to list them.", revision))
+		return
+	}
+
+	restored := &GuildConfig{}
+	if err := json.Unmarshal(target.Settings, restored); err != nil {
+		interactionLog(i).Error("Error restoring config revision", "revision", revision, "err", err)
+		respondEphemeral(s, i, fmt.Sprintf("❌ Revision #%d could not be read.", revision))
+		return
+	}
+
+	before := cfg.setGuild(i.GuildID, restored)
+	// The audit entry is the log channel's record of the rollback.
+	saveGuildConfig(s, i.GuildID, before, i.Member.User, fmt.Sprintf("Rollback to #%d", revision))
+	interactionLog(i).Info("Config rolled back", "revision", revision)
+	respondEphemeral(s, i, fmt.Sprintf("✅ Restored revision **#%d** (%s by %s).", revision, target.Source, target.Author))
+}
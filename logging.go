@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// initLogging sets up the default structured logger from the environment:
+// MODMAIL_LOG_LEVEL is debug, info (default), warn or error, and MODMAIL_LOG_FORMAT is
+// text (default) or json. The standard log package and discordgo's own logging are routed
+// through it too, and problems are passed on to the ops channel reporter. It runs before the
+// config file is read, so only the environment counts.
+func initLogging() {
+	var level slog.Level
+	if name := os.Getenv("MODMAIL_LOG_LEVEL"); name != "" {
+		if err := level.UnmarshalText([]byte(name)); err != nil {
+			fmt.Fprintf(os.Stderr, "Unknown MODMAIL_LOG_LEVEL %q, using info.\n", name)
+			level = slog.LevelInfo
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, opts)
+	switch format := strings.ToLower(os.Getenv("MODMAIL_LOG_FORMAT")); format {
+	case "", "text":
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown MODMAIL_LOG_FORMAT %q, using text.\n", format)
+	}
+	opsFallback = slog.New(handler)
+	slog.SetDefault(slog.New(&opsHandler{next: handler}))
+
+	discordgo.Logger = func(msgL, caller int, format string, a ...interface{}) {
+		level := slog.LevelDebug
+		switch msgL {
+		case discordgo.LogError:
+			level = slog.LevelError
+		case discordgo.LogWarning:
+			level = slog.LevelWarn
+		case discordgo.LogInformational:
+			level = slog.LevelInfo
+		}
+		slog.Log(context.Background(), level, strings.TrimSpace(fmt.Sprintf(format, a...)), "source", "discordgo")
+	}
+}
+
+// ticketLog returns a logger that tags every line with the ticket (its channel or thread
+// ID), the ticket's user and its guild.
+func ticketLog(t *Ticket) *slog.Logger {
+	return slog.With("ticket_id", t.ChannelID, "user_id", t.UserID, "guild_id", t.GuildID)
+}
+
+// interactionLog returns a logger that tags every line with where an interaction came from
+// and who used it.
+func interactionLog(i *discordgo.InteractionCreate) *slog.Logger {
+	l := slog.With("guild_id", i.GuildID, "channel_id", i.ChannelID, "user_id", interactionUser(i).ID)
+	if t, ok := activeTickets.forChannel(i.ChannelID); ok {
+		l = l.With("ticket_id", t.ChannelID)
+	}
+	return l
+}
+
+// sendMessage posts a message for callers that carry on whether or not it arrives, logging
+// a failure instead of returning it.
+func sendMessage(s *discordgo.Session, l *slog.Logger, channelID, content string) {
+	if _, err := s.ChannelMessageSend(channelID, content); err != nil {
+		l.Error("Error sending message", "channel_id", channelID, "err", err)
+	}
+}
+
+// sendEmbed is sendMessage for embeds.
+func sendEmbed(s *discordgo.Session, l *slog.Logger, channelID string, embed *discordgo.MessageEmbed) {
+	if _, err := s.ChannelMessageSendEmbed(channelID, embed); err != nil {
+		l.Error("Error sending embed", "channel_id", channelID, "title", embed.Title, "err", err)
+	}
+}
+
+// respond answers an interaction, logging a failure instead of returning it.
+func respond(s *discordgo.Session, i *discordgo.InteractionCreate, resp *discordgo.InteractionResponse) {
+	if err := s.InteractionRespond(i.Interaction, resp); err != nil {
+		interactionLog(i).Error("Error responding to interaction", "err", err)
+	}
+}
@@ -1,8 +1,9 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -11,28 +12,46 @@ import (
 	"github.com/bwmarrin/discordgo"
 )
 
-// Global map to keep track of active tickets: UserID -> TicketChannelID
-var activeTickets = make(map[string]string)
+// Global store to keep track of active tickets: UserID -> Ticket
+var activeTickets = newTicketStore()
 var cfg Config
 
 func main() {
+	checkOnly := flag.Bool("check-config", false, "validate the configuration, print the effective settings and exit")
+	flag.Parse()
+	initLogging()
+	if *checkOnly {
+		os.Exit(checkConfig())
+	}
+
 	// 1. Load Configuration
-	cfg = LoadConfig()
-	if cfg.BotToken == "" {
-		log.Fatal("DISCORD_BOT_TOKEN environment variable not set.")
+	var err error
+	cfg, err = LoadConfig()
+	if err != nil {
+		slog.Error("Error loading configuration", "err", err)
+		os.Exit(1)
+	}
+	initConfigHistory()
+	subscribeTicketEvents()
+	if cfg.Secrets.BotToken == "" {
+		slog.Error("Bot token not set. Set DISCORD_BOT_TOKEN or put BotToken in the secrets file.")
+		os.Exit(1)
 	}
-    if cfg.GuildID == "" {
-        log.Fatal("DISCORD_GUILD_ID environment variable not set.")
-    }
 
 	// 2. Create a new Discord session
-	dg, err := discordgo.New("Bot " + cfg.BotToken)
+	dg, err := discordgo.New("Bot " + cfg.Secrets.BotToken.reveal())
 	if err != nil {
-		log.Fatalf("Error creating Discord session: %v", err)
+		slog.Error("Error creating Discord session", "err", err)
+		os.Exit(1)
 	}
 
+	instrumentSession(dg)
+	initOps(dg)
+	trackGatewayState(dg)
+
 	// 3. Add event handlers
 	dg.AddHandler(ready)
+	dg.AddHandler(guildCreate)
 	dg.AddHandler(handleMessageCreate)
 	dg.AddHandler(handleInteractionCreate)
 
@@ -45,40 +64,64 @@ func main() {
 	// 4. Open a websocket connection to Discord
 	err = dg.Open()
 	if err != nil {
-		log.Fatalf("Error opening connection: %v", err)
+		slog.Error("Error opening connection", "err", err)
+		os.Exit(1)
 	}
 
-	// 5. Register slash commands
-	registerCommands(dg, cfg.GuildID)
+	// 5. Slash commands are synced per guild as each GuildCreate event arrives
+
+	go watchConfig(dg)
 
-	// 6. Start a simple web server for Render health checks
+	// 6. Start a simple web server for Render health checks (point Render's health check at /readyz)
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080" // Default port if not set by Render
 	}
 
 	go func() {
+		http.HandleFunc("/metrics", handleMetrics)
+		http.HandleFunc("/healthz", handleHealthz)
+		http.HandleFunc("/readyz", readyzHandler(dg))
+		registerDashboard(dg)
+		registerAPI(dg)
 		http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 			fmt.Fprint(w, "ModMail Bot is running!")
 		})
-		log.Printf("Starting web server on port %s for Render health check...", port)
+		slog.Info("Starting web server for Render health check", "port", port)
 		if err := http.ListenAndServe(":"+port, nil); err != nil {
-			log.Fatalf("Error starting web server: %v", err)
+			slog.Error("Error starting web server", "port", port, "err", err)
+			os.Exit(1)
 		}
 	}()
 
 	// 7. Wait for an interrupt signal
-	fmt.Println("Bot is now running. Press CTRL-C to exit.")
+	slog.Info("Bot is now running. Press CTRL-C to exit.")
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, syscall.SIGKILL)
 	<-sc
 
 	// 8. Cleanly close down the Discord session
-	deregisterCommands(dg, cfg.GuildID)
-	dg.Close()
+	// Commands are left registered so they stay usable across restarts and deploys.
+	if err := dg.Close(); err != nil {
+		slog.Warn("Error closing Discord session", "err", err)
+	}
 }
 
 func ready(s *discordgo.Session, event *discordgo.Ready) {
-	s.UpdateGameStatus(0, "DM me for support!")
-	log.Printf("Bot is ready. User: %s#%s", event.User.Username, event.User.Discriminator)
+	defer recoverPanic(slog.Default(), "ready")
+	if err := s.UpdateGameStatus(0, "DM me for support!"); err != nil {
+		slog.Warn("Error setting bot status", "err", err)
+	}
+	slog.Info("Bot is ready", "user", event.User.String(), "user_id", event.User.ID)
+}
+
+// guildCreate fires for every guild on startup and whenever the bot joins a new one.
+func guildCreate(s *discordgo.Session, event *discordgo.GuildCreate) {
+	if event.Unavailable {
+		return
+	}
+	defer recoverPanic(slog.With("guild_id", event.ID), "guild create")
+	if err := syncCommands(s, event.ID); err != nil {
+		slog.Error("Error syncing commands", "guild_id", event.ID, "err", err)
+	}
 }
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// A small registry written out in the Prometheus text format on /metrics. Metrics are
+// package variables that the ticket and handler code update directly.
+
+var (
+	metricTicketsOpened = newCounter("modmail_tickets_opened_total",
+		"Tickets opened, by who opened them (user or staff).", "opened_by")
+	metricTicketsClosed = newCounter("modmail_tickets_closed_total",
+		"Tickets closed or deleted.")
+	metricMessagesRelayed = newCounter("modmail_messages_relayed_total",
+		"Messages relayed between users and staff, by direction (to_staff or to_user).", "direction")
+	metricRelayFailures = newCounter("modmail_relay_failures_total",
+		"Messages that could not be relayed, by direction (to_staff or to_user).", "direction")
+	metricDMDisabled = newCounter("modmail_dm_disabled_total",
+		"DMs that failed because the user has DMs from the server disabled or blocked the bot.")
+	metricFirstResponse = newHistogram("modmail_first_response_seconds",
+		"Time from a user opening a ticket to the first staff reply.",
+		[]float64{60, 300, 900, 1800, 3600, 3 * 3600, 6 * 3600, 12 * 3600, 24 * 3600, 72 * 3600})
+	metricAPILatency = newHistogram("modmail_discord_api_request_duration_seconds",
+		"Latency of Discord REST API requests, by method and status code.",
+		[]float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20}, "method", "code")
+	metricReconnects = newCounter("modmail_gateway_reconnects_total",
+		"Gateway reconnections (resumed or re-identified) since startup.")
+)
+
+// metric is anything the registry can write out.
+type metric interface {
+	writeTo(w io.Writer)
+}
+
+var metricsRegistry []metric
+
+// handleMetrics serves every registered metric.
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, m := range metricsRegistry {
+		m.writeTo(w)
+	}
+}
+
+// counterVec is a counter with optional labels.
+type counterVec struct {
+	name, help string
+	labels     []string
+	mu         sync.Mutex
+	values     map[string]float64 // Keyed by seriesKey(label values)
+}
+
+func newCounter(name, help string, labels ...string) *counterVec {
+	c := &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+	if len(labels) == 0 {
+		c.values[""] = 0 // Report unlabelled counters from the start
+	}
+	metricsRegistry = append(metricsRegistry, c)
+	return c
+}
+
+func (c *counterVec) inc(labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[seriesKey(labelValues)]++
+}
+
+func (c *counterVec) writeTo(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, key, ""), formatFloat(c.values[key]))
+	}
+}
+
+// histogramVec is a histogram with optional labels.
+type histogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64 // Upper bounds, ascending; +Inf is implied
+	mu         sync.Mutex
+	series     map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 // Per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(name, help string, buckets []float64, labels ...string) *histogramVec {
+	h := &histogramVec{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogramSeries)}
+	metricsRegistry = append(metricsRegistry, h)
+	return h
+}
+
+func (h *histogramVec) observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := seriesKey(labelValues)
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+			break
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+func (h *histogramVec) writeTo(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := h.series[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, key, formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, key, "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, key, ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, key, ""), s.count)
+	}
+}
+
+// seriesKey joins label values with a byte that can't appear in them.
+func seriesKey(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatLabels renders {name="value",...}, adding le for histogram buckets.
+func formatLabels(names []string, key, le string) string {
+	var pairs []string
+	if len(names) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, fmt.Sprintf("%s=%q", names[i], value))
+		}
+	}
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf("le=%q", le))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// instrumentedTransport times every Discord REST request.
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+func (t instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	metricAPILatency.observe(time.Since(start).Seconds(), req.Method, code)
+	return resp, err
+}
+
+// instrumentSession hooks API latency and gateway reconnect metrics into a session.
+func instrumentSession(dg *discordgo.Session) {
+	next := dg.Client.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	dg.Client.Transport = instrumentedTransport{next: next}
+
+	// Connect fires on every successful gateway connection, resumed or not, so every one
+	// after the first is a reconnect.
+	var connectsMu sync.Mutex
+	connects := 0
+	dg.AddHandler(func(s *discordgo.Session, _ *discordgo.Connect) {
+		connectsMu.Lock()
+		defer connectsMu.Unlock()
+		connects++
+		if connects > 1 {
+			metricReconnects.inc()
+		}
+	})
+}
+
+// recordRelayFailure counts a message that could not be relayed in one direction.
+func recordRelayFailure(direction string, err error) {
+	metricRelayFailures.inc(direction)
+	if isDMDisabled(err) {
+		metricDMDisabled.inc()
+	}
+}
+
+// recordTicketMetrics counts opened and closed tickets and relayed messages, and observes
+// the time to the first staff reply.
+func recordTicketMetrics(s *discordgo.Session, e TicketEvent) {
+	switch e := e.(type) {
+	case TicketOpened:
+		openedBy := "user"
+		if e.OpenedBy != nil {
+			openedBy = "staff"
+		}
+		metricTicketsOpened.inc(openedBy)
+	case MessageRelayed:
+		if !e.Message.FromStaff {
+			metricMessagesRelayed.inc("to_staff")
+			return
+		}
+		metricMessagesRelayed.inc("to_user")
+		recordFirstResponse(e.Ticket.ChannelID)
+	case TicketClosed:
+		metricTicketsClosed.inc()
+	}
+}
+
+// isDMDisabled reports whether Discord refused a DM because of the user's privacy settings.
+func isDMDisabled(err error) bool {
+	var restErr *discordgo.RESTError
+	return errors.As(err, &restErr) && restErr.Message != nil &&
+		restErr.Message.Code == discordgo.ErrCodeCannotSendMessagesToThisUser
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// withRegistry swaps in an empty registry for the duration of a test.
+func withRegistry(t *testing.T) {
+	saved := metricsRegistry
+	metricsRegistry = nil
+	t.Cleanup(func() { metricsRegistry = saved })
+}
+
+func scrape(t *testing.T) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handleMetrics(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the Prometheus text format", ct)
+	}
+	return rec.Body.String()
+}
+
+func TestMetricsExposition(t *testing.T) {
+	withRegistry(t)
+	plain := newCounter("test_plain_total", "An unlabelled counter.")
+	labelled := newCounter("test_labelled_total", "A labelled counter.", "direction", "kind")
+	hist := newHistogram("test_seconds", "A histogram.", []float64{0.5, 1, 2.5}, "method")
+
+	plain.inc()
+	plain.inc()
+	labelled.inc("to_user", "dm")
+	labelled.inc("to_staff", `say "hi"\`)
+	hist.observe(0.2, "GET")
+	hist.observe(0.7, "GET")
+	hist.observe(10, "GET")
+	hist.observe(1, "POST")
+
+	want := `# HELP test_plain_total An unlabelled counter.
+# TYPE test_plain_total counter
+test_plain_total 2
+# HELP test_labelled_total A labelled counter.
+# TYPE test_labelled_total counter
+test_labelled_total{direction="to_staff",kind="say \"hi\"\\"} 1
+test_labelled_total{direction="to_user",kind="dm"} 1
+# HELP test_seconds A histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{method="GET",le="0.5"} 1
+test_seconds_bucket{method="GET",le="1"} 2
+test_seconds_bucket{method="GET",le="2.5"} 2
+test_seconds_bucket{method="GET",le="+Inf"} 3
+test_seconds_sum{method="GET"} 10.9
+test_seconds_count{method="GET"} 3
+test_seconds_bucket{method="POST",le="0.5"} 0
+test_seconds_bucket{method="POST",le="1"} 1
+test_seconds_bucket{method="POST",le="2.5"} 1
+test_seconds_bucket{method="POST",le="+Inf"} 1
+test_seconds_sum{method="POST"} 1
+test_seconds_count{method="POST"} 1
+`
+	if got := scrape(t); got != want {
+		t.Errorf("/metrics output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMetricsBeforeObservations(t *testing.T) {
+	withRegistry(t)
+	newCounter("test_idle_total", "Never incremented.")
+	newCounter("test_idle_labelled_total", "Never incremented.", "kind")
+	newHistogram("test_idle_seconds", "Never observed.", []float64{1})
+
+	want := `# HELP test_idle_total Never incremented.
+# TYPE test_idle_total counter
+test_idle_total 0
+# HELP test_idle_labelled_total Never incremented.
+# TYPE test_idle_labelled_total counter
+# HELP test_idle_seconds Never observed.
+# TYPE test_idle_seconds histogram
+`
+	if got := scrape(t); got != want {
+		t.Errorf("/metrics output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// TestMetricsWellFormed checks every line the bot's own metrics produce against the text
+// format's grammar.
+func TestMetricsWellFormed(t *testing.T) {
+	metricTicketsOpened.inc("user")
+	metricAPILatency.observe(0.3, "GET", "200")
+
+	comment := regexp.MustCompile(`^# (HELP|TYPE) [a-zA-Z_:][a-zA-Z0-9_:]* .+$`)
+	sample := regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*(\{[a-zA-Z_][a-zA-Z0-9_]*="(\\.|[^"\\])*"(,[a-zA-Z_][a-zA-Z0-9_]*="(\\.|[^"\\])*")*\})? ([-+0-9.eE]+|\+Inf|NaN)$`)
+	body := scrape(t)
+	for _, line := range strings.Split(strings.TrimSuffix(body, "\n"), "\n") {
+		if !comment.MatchString(line) && !sample.MatchString(line) {
+			t.Errorf("malformed line: %q", line)
+		}
+	}
+	for _, name := range []string{"modmail_tickets_opened_total", "modmail_discord_api_request_duration_seconds"} {
+		if !strings.Contains(body, "# TYPE "+name+" ") {
+			t.Errorf("%s is missing from /metrics", name)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Problems are reported to a guild's ops channel when one is configured: error log lines
+// tagged with the guild, permission errors, panics and API rate limits. Panics and rate
+// limits that belong to no guild go to every ops channel. Repeats of
+// the same problem are counted rather than posted, and each guild gets a limited number of
+// reports per minute so an outage does not flood the channel.
+const (
+	opsDedupWindow = 10 * time.Minute
+	opsRateWindow  = time.Minute
+	opsRateLimit   = 5 // Reports posted per guild per opsRateWindow
+)
+
+// opsReport is one problem to post.
+type opsReport struct {
+	title string
+	err   string
+	attrs []slog.Attr // Context shown as embed fields
+	stack string
+}
+
+type opsSeen struct {
+	at      time.Time
+	repeats int
+}
+
+var ops struct {
+	sync.Mutex
+	session *discordgo.Session
+	seen    map[string]*opsSeen    // Last posting of each problem, keyed by guild, title and error
+	posted  map[string][]time.Time // Recent postings per guild
+	dropped map[string]int         // Reports per guild held back by the rate limit since the last posting
+}
+
+// opsFallback logs without reporting, for failures of the reporter itself.
+var opsFallback = slog.Default()
+
+// initOps starts reporting through the session.
+func initOps(s *discordgo.Session) {
+	ops.Lock()
+	defer ops.Unlock()
+	ops.session = s
+	ops.seen = make(map[string]*opsSeen)
+	ops.posted = make(map[string][]time.Time)
+	ops.dropped = make(map[string]int)
+	s.AddHandler(reportRateLimit)
+}
+
+// reportOps posts a report to the guild's ops channel unless the same problem was posted
+// recently or the guild has hit the rate limit. It may block on the config lock and the
+// Discord API, so callers that hold locks run it in a goroutine.
+func reportOps(guildID string, r opsReport) {
+	defer recoverPanic(opsFallback, "ops report")
+	gc := cfg.guild(guildID)
+	if gc == nil || gc.OpsChannelID == "" {
+		return
+	}
+
+	ops.Lock()
+	s := ops.session
+	if s == nil {
+		ops.Unlock()
+		return
+	}
+	now := time.Now()
+	key := guildID + "\x00" + r.title + "\x00" + r.err
+	seen := ops.seen[key]
+	if seen != nil && now.Sub(seen.at) < opsDedupWindow {
+		seen.repeats++
+		ops.Unlock()
+		return
+	}
+	recent := ops.posted[guildID][:0]
+	for _, at := range ops.posted[guildID] {
+		if now.Sub(at) < opsRateWindow {
+			recent = append(recent, at)
+		}
+	}
+	if len(recent) >= opsRateLimit {
+		ops.posted[guildID] = recent
+		ops.dropped[guildID]++
+		ops.Unlock()
+		return
+	}
+	ops.posted[guildID] = append(recent, now)
+	repeats, dropped := 0, ops.dropped[guildID]
+	if seen != nil {
+		repeats = seen.repeats
+	}
+	ops.seen[key] = &opsSeen{at: now}
+	delete(ops.dropped, guildID)
+	for k, v := range ops.seen {
+		if now.Sub(v.at) >= opsDedupWindow {
+			delete(ops.seen, k)
+		}
+	}
+	ops.Unlock()
+
+	if _, err := s.ChannelMessageSendEmbed(gc.OpsChannelID, r.embed(now, repeats, dropped)); err != nil {
+		opsFallback.Error("Error posting to ops channel", "guild_id", guildID, "channel_id", gc.OpsChannelID, "err", err)
+	}
+}
+
+func (r opsReport) embed(now time.Time, repeats, dropped int) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:     "⚠️ " + truncate(r.title, 250),
+		Color:     0xED4245, // Red
+		Timestamp: now.Format(time.RFC3339),
+	}
+	if r.err != "" {
+		embed.Description = "```\n" + truncate(r.err, 4000) + "\n```"
+	}
+	for _, a := range r.attrs {
+		value := a.Value.String()
+		switch a.Key {
+		case "ticket_id", "channel_id":
+			value = "<#" + value + ">"
+		case "user_id", "staff_id", "member_id", "target_id":
+			value = "<@" + value + ">"
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: a.Key, Value: truncate(value, 1024), Inline: true})
+	}
+	if r.stack != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "stack", Value: "```\n" + truncate(r.stack, 1000) + "\n```"})
+	}
+
+	var notes []string
+	if repeats > 0 {
+		notes = append(notes, fmt.Sprintf("Happened %d more times since it was last reported", repeats))
+	}
+	if dropped > 0 {
+		notes = append(notes, fmt.Sprintf("%d other reports were held back by the rate limit", dropped))
+	}
+	if len(notes) > 0 {
+		embed.Footer = &discordgo.MessageEmbedFooter{Text: strings.Join(notes, " · ")}
+	}
+	return embed
+}
+
+// opsHandler passes log records on to the next handler and reports error lines and
+// permission errors that are tagged with a guild. It reports warnings even when the log
+// level hides them.
+type opsHandler struct {
+	next  slog.Handler
+	attrs []slog.Attr
+}
+
+func (h *opsHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= slog.LevelWarn || h.next.Enabled(ctx, level)
+}
+
+func (h *opsHandler) Handle(ctx context.Context, r slog.Record) error {
+	var err error
+	if h.next.Enabled(ctx, r.Level) {
+		err = h.next.Handle(ctx, r)
+	}
+	if r.Level < slog.LevelWarn {
+		return err
+	}
+
+	var guildID string
+	var cause error
+	var panicked bool
+	report := opsReport{title: r.Message}
+	collect := func(a slog.Attr) bool {
+		switch a.Key {
+		case "guild_id":
+			guildID = a.Value.String()
+		case "err":
+			report.err = a.Value.String()
+			cause, _ = a.Value.Any().(error)
+		case "stack":
+			report.stack = a.Value.String()
+		case "panic":
+			panicked = true
+			report.attrs = append(report.attrs, a)
+		default:
+			report.attrs = append(report.attrs, a)
+		}
+		return true
+	}
+	for _, a := range h.attrs {
+		collect(a)
+	}
+	r.Attrs(collect)
+
+	if guildID == "" && panicked {
+		reportOpsAll(report)
+		return err
+	}
+	if guildID == "" || (r.Level < slog.LevelError && !isMissingPermissions(cause)) {
+		return err
+	}
+	if isMissingPermissions(cause) {
+		report.title = "Missing permissions: " + report.title
+	}
+	go reportOps(guildID, report)
+	return err
+}
+
+func (h *opsHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &opsHandler{next: h.next.WithAttrs(attrs), attrs: append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...)}
+}
+
+func (h *opsHandler) WithGroup(name string) slog.Handler {
+	return &opsHandler{next: h.next.WithGroup(name), attrs: h.attrs}
+}
+
+// isMissingPermissions reports whether Discord refused a request because the bot lacks a
+// permission or cannot see the channel.
+func isMissingPermissions(err error) bool {
+	var restErr *discordgo.RESTError
+	return errors.As(err, &restErr) && restErr.Message != nil &&
+		(restErr.Message.Code == discordgo.ErrCodeMissingPermissions || restErr.Message.Code == discordgo.ErrCodeMissingAccess)
+}
+
+// recoverPanic logs a panic in an event handler with its stack instead of letting it crash
+// the bot. Defer it directly.
+func recoverPanic(l *slog.Logger, handler string) {
+	if r := recover(); r != nil {
+		l.Error("Handler panicked", "handler", handler, "panic", r, "stack", string(debug.Stack()))
+	}
+}
+
+// reportRateLimit reports a rate-limited API request to every guild with an ops channel,
+// since the bot's rate limits are shared between them.
+func reportRateLimit(s *discordgo.Session, rl *discordgo.RateLimit) {
+	slog.Warn("Rate limited by Discord", "url", rl.URL, "bucket", rl.Bucket, "retry_after", rl.RetryAfter)
+	report := opsReport{
+		title: "Rate limited by Discord",
+		err:   rl.Message,
+		attrs: []slog.Attr{
+			slog.String("bucket", rl.Bucket),
+			slog.Duration("retry_after", rl.RetryAfter),
+		},
+	}
+	reportOpsAll(report)
+}
+
+// reportOpsAll reports a problem that is not specific to one guild to every ops channel.
+func reportOpsAll(r opsReport) {
+	go func() {
+		defer recoverPanic(opsFallback, "ops report")
+		for guildID, gc := range cfg.guilds() {
+			if gc.OpsChannelID != "" {
+				go reportOps(guildID, r)
+			}
+		}
+	}()
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// StaffLevel ranks what a member may do with ModMail. Higher levels include the lower ones.
+type StaffLevel int
+
+const (
+	LevelNone StaffLevel = iota
+	LevelHelper
+	LevelModerator
+	LevelAdmin
+)
+
+var staffLevelNames = map[StaffLevel]string{
+	LevelNone:      "none",
+	LevelHelper:    "helper",
+	LevelModerator: "moderator",
+	LevelAdmin:     "admin",
+}
+
+func (l StaffLevel) String() string {
+	if name, ok := staffLevelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level-%d", int(l))
+}
+
+// MarshalText stores levels by name so config.json stays readable.
+func (l StaffLevel) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *StaffLevel) UnmarshalText(text []byte) error {
+	parsed, err := parseStaffLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = parsed
+	return nil
+}
+
+func parseStaffLevel(name string) (StaffLevel, error) {
+	for level, n := range staffLevelNames {
+		if strings.EqualFold(n, name) {
+			return level, nil
+		}
+	}
+	return LevelNone, fmt.Errorf("unknown staff level %q (want helper, moderator or admin)", name)
+}
+
+// StaffRole grants every member with the role a staff level.
+type StaffRole struct {
+	RoleID string
+	Level  StaffLevel
+}
+
+// defaultCommandLevels is the minimum level for each command unless a guild overrides it
+// in CommandLevels. Commands not listed here are open to everyone.
+var defaultCommandLevels = map[string]StaffLevel{
+	"modmail-setup":      LevelAdmin,
+	"modmail-set-config": LevelAdmin,
+	"modmail-config":     LevelAdmin,
+	"modmail-commands":   LevelAdmin,
+	"modmail-webhooks":   LevelAdmin,
+	"audit":              LevelAdmin,
+	"contact":            LevelHelper,
+	"claim":              LevelHelper,
+	"close":              LevelHelper,
+	"delete":             LevelModerator,
+}
+
+// commandLevel returns the minimum level required to run a command in the guild.
+func (gc *GuildConfig) commandLevel(name string) StaffLevel {
+	if gc != nil {
+		if level, ok := gc.CommandLevels[name]; ok {
+			return level
+		}
+	}
+	return defaultCommandLevels[name]
+}
+
+// memberLevel works out a member's staff level in a guild. Server administrators are always
+// admins; the guild's staff role and the department's staff role make a member a helper;
+// StaffRoles can grant any level. gc may be nil for guilds that have not been set up yet.
+func memberLevel(member *discordgo.Member, gc *GuildConfig, dept Department) StaffLevel {
+	if member == nil {
+		return LevelNone
+	}
+	if member.Permissions&discordgo.PermissionAdministrator != 0 {
+		return LevelAdmin
+	}
+	if gc == nil {
+		return LevelNone
+	}
+
+	level := LevelNone
+	for _, roleID := range member.Roles {
+		if roleID == "" {
+			continue
+		}
+		if roleID == dept.StaffRoleID || roleID == gc.StaffRoleID {
+			level = max(level, LevelHelper)
+		}
+		for _, sr := range gc.StaffRoles {
+			if sr.RoleID == roleID {
+				level = max(level, sr.Level)
+			}
+		}
+	}
+	return level
+}
+
+// departmentOption returns the value of the command's department option, if it has one.
+func departmentOption(i *discordgo.InteractionCreate) string {
+	for _, option := range i.ApplicationCommandData().Options {
+		if option.Name == "department" && option.Type == discordgo.ApplicationCommandOptionString {
+			return option.StringValue()
+		}
+	}
+	return ""
+}
+
+// authorizeCommand checks the invoking member against the command's minimum level before any
+// handler runs. Inside a ticket channel the ticket's department decides which staff role
+// counts; elsewhere the command's department option does, as for /contact. It responds with an error and returns false when the member may not run the command.
+func authorizeCommand(s *discordgo.Session, i *discordgo.InteractionCreate) bool {
+	name := i.ApplicationCommandData().Name
+	gc := cfg.guild(i.GuildID)
+	required := gc.commandLevel(name)
+	if required == LevelNone {
+		return true
+	}
+
+	var dept Department
+	if gc != nil {
+		dept = gc.department("")
+		if ticket, ok := activeTickets.forChannel(i.ChannelID); ok {
+			dept = gc.department(ticket.Department)
+		} else if deptID := departmentOption(i); gc.hasDepartment(deptID) {
+			dept = gc.department(deptID)
+		}
+	}
+
+	if memberLevel(i.Member, gc, dept) >= required {
+		return true
+	}
+	respondEphemeral(s, i, fmt.Sprintf("❌ You need the **%s** staff level to use `/%s`.", required, name))
+	return false
+}
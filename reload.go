@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// configPollInterval is how often config.json is checked for changes.
+const configPollInterval = 2 * time.Second
+
+// watchConfig reloads config.json when it changes on disk or the process receives SIGHUP.
+// Changes are detected by polling the file's modification time, then comparing checksums so
+// the bot's own saves don't trigger a reload.
+func watchConfig(s *discordgo.Session) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var lastMod time.Time
+	if info, err := os.Stat(configFileName); err == nil {
+		lastMod = info.ModTime()
+	}
+
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-hup:
+			reloadConfig(s, "SIGHUP")
+		case <-ticker.C:
+			if configChanged(&lastMod) {
+				reloadConfig(s, "file change")
+			}
+		}
+	}
+}
+
+// configChanged reports whether config.json was modified since lastMod by something other
+// than the bot, and records the new modification time. The file is read under the config
+// lock so a save in progress is never mistaken for an outside edit.
+func configChanged(lastMod *time.Time) bool {
+	cfgMu.RLock()
+	defer cfgMu.RUnlock()
+	info, err := os.Stat(configFileName)
+	if err != nil || info.ModTime().Equal(*lastMod) {
+		return false
+	}
+	*lastMod = info.ModTime()
+
+	data, err := os.ReadFile(configFileName)
+	if err != nil {
+		return false
+	}
+	return sha256.Sum256(data) != lastConfigSum
+}
+
+// reloadConfig reads and validates config.json and swaps it in. On error the current
+// configuration stays in place. Either way the result is posted to the log channels.
+func reloadConfig(s *discordgo.Session, trigger string) {
+	defer recoverPanic(slog.With("trigger", trigger), "config reload")
+	next, data, err := readConfigFile()
+	if err != nil {
+		slog.Error("Config reload failed, keeping the current configuration", "trigger", trigger, "err", err)
+		announceReload(s, cfg.guilds(), &discordgo.MessageEmbed{
+			Title:       "❌ Configuration Reload Failed",
+			Description: truncate(fmt.Sprintf("Triggered by %s. The previous configuration is still in use.\n```%v```", trigger, err), 4096),
+			Color:       0xFF0000, // Red
+			Timestamp:   time.Now().Format(time.RFC3339),
+		})
+		return
+	}
+
+	before := cfg.guilds()
+	cfgMu.Lock()
+	cfg.GuildID = next.GuildID
+	cfg.Guilds = next.Guilds
+	cfg.env = next.env
+	lastConfigSum = sha256.Sum256(data)
+	cfgMu.Unlock()
+
+	slog.Info("Configuration reloaded", "file", configFileName, "trigger", trigger)
+	recordReloadRevisions(before, trigger)
+	announceReload(s, next.Guilds, &discordgo.MessageEmbed{
+		Title:       "🔄 Configuration Reloaded",
+		Description: fmt.Sprintf("`%s` was reloaded (triggered by %s).", configFileName, trigger),
+		Color:       0x00FF00, // Green
+		Timestamp:   time.Now().Format(time.RFC3339),
+	})
+}
+
+// announceReload posts the reload result to each guild's log channel.
+func announceReload(s *discordgo.Session, guilds map[string]*GuildConfig, embed *discordgo.MessageEmbed) {
+	for guildID, gc := range guilds {
+		if gc == nil || gc.LogChannelID == "" {
+			continue
+		}
+		if _, err := s.ChannelMessageSendEmbed(gc.LogChannelID, embed); err != nil {
+			slog.Error("Error posting config reload result", "guild_id", guildID, "channel_id", gc.LogChannelID, "err", err)
+		}
+	}
+}
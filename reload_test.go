@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// withConfigFile points the bot at a config file in a temporary directory and restores the
+// global config afterwards.
+func withConfigFile(t *testing.T) string {
+	savedName, savedGuilds, savedSum := configFileName, cfg.Guilds, lastConfigSum
+	configFileName = filepath.Join(t.TempDir(), "config.json")
+	cfg.Guilds = map[string]*GuildConfig{}
+	t.Cleanup(func() {
+		cfgMu.Lock()
+		configFileName, cfg.Guilds, lastConfigSum = savedName, savedGuilds, savedSum
+		cfgMu.Unlock()
+	})
+	return configFileName
+}
+
+func TestConfigWatcherIgnoresOwnSaves(t *testing.T) {
+	path := withConfigFile(t)
+	cfg.SaveConfig()
+
+	var lastMod time.Time
+	configChanged(&lastMod)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			cfg.setGuild("111", &GuildConfig{LogChannelID: strconv.Itoa(i), ModMailCategoryID: string(make([]byte, 4096))})
+			cfg.SaveConfig()
+		}
+	}()
+	for polling := true; polling; {
+		select {
+		case <-done:
+			polling = false
+		default:
+			if configChanged(&lastMod) {
+				t.Error("the watcher saw the bot's own save as an outside change")
+				polling = false
+			}
+			// Readers that don't take the config lock, such as an operator's editor, never
+			// see a partly written file either.
+			data, err := os.ReadFile(path)
+			if err == nil {
+				_, err = decodeConfig(data, "json")
+			}
+			if err != nil {
+				t.Errorf("read a partly written config file: %v", err)
+				polling = false
+			}
+		}
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("config file mode = %v, want 0600", mode)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("temporary files left next to the config file: %v", entries)
+	}
+
+	// An outside edit is still picked up.
+	time.Sleep(10 * time.Millisecond)
+	if err := os.WriteFile(path, []byte(`{"Version": 2}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if !configChanged(&lastMod) {
+		t.Error("the watcher missed an outside edit")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+const defaultSecretsFileName = "secrets.json"
+
+// secret is a credential. It prints and marshals as "[redacted]" so it can't leak through a
+// log line or a config dump; use reveal() where the real value is needed.
+type secret string
+
+func (s secret) reveal() string { return string(s) }
+
+func (s secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+func (s secret) GoString() string { return fmt.Sprintf("%q", s.String()) }
+
+func (s secret) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+// Secrets holds credentials. They are read from the environment or a secrets file and are
+// never written to config.json.
+type Secrets struct {
+	BotToken          secret // DISCORD_BOT_TOKEN
+	DashboardPassword secret // MODMAIL_DASHBOARD_PASSWORD; the web dashboard is off without it
+	APIToken          secret // MODMAIL_API_TOKEN; the REST API is off without it
+	WebhookSecret     secret // MODMAIL_WEBHOOK_SECRET; signs outgoing webhooks, which are off without it
+}
+
+// loadSecrets reads the secrets file (MODMAIL_SECRETS_FILE, default secrets.json) if it
+// exists, then lets environment variables override it. The file uses the field names of
+// Secrets as keys.
+func loadSecrets() Secrets {
+	var secrets Secrets
+	sources := []struct {
+		value *secret
+		key   string
+		env   string
+	}{
+		{&secrets.BotToken, "BotToken", "DISCORD_BOT_TOKEN"},
+		{&secrets.DashboardPassword, "DashboardPassword", "MODMAIL_DASHBOARD_PASSWORD"},
+		{&secrets.APIToken, "APIToken", "MODMAIL_API_TOKEN"},
+		{&secrets.WebhookSecret, "WebhookSecret", "MODMAIL_WEBHOOK_SECRET"},
+	}
+
+	path := os.Getenv("MODMAIL_SECRETS_FILE")
+	if path == "" {
+		path = defaultSecretsFileName
+	}
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode().Perm()&0077 != 0 {
+			slog.Warn("Secrets file is readable by other users; run chmod 600 on it", "file", path, "mode", info.Mode().Perm().String())
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			slog.Error("Error reading secrets file", "file", path, "err", err)
+		} else {
+			var file map[string]string
+			if err := json.Unmarshal(data, &file); err != nil {
+				slog.Error("Error unmarshalling secrets file", "file", path, "err", err)
+			}
+			for _, src := range sources {
+				*src.value = secret(strings.TrimSpace(file[src.key]))
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		slog.Error("Error reading secrets file", "file", path, "err", err)
+	}
+
+	for _, src := range sources {
+		if value := os.Getenv(src.env); value != "" {
+			*src.value = secret(value)
+		}
+	}
+	return secrets
+}
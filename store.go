@@ -0,0 +1,161 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// TicketStatus tracks where a ticket is in its lifecycle.
+type TicketStatus string
+
+const (
+	StatusOpen    TicketStatus = "open"
+	StatusClaimed TicketStatus = "claimed"
+	StatusClosed  TicketStatus = "closed"
+)
+
+// Ticket links a user to the channel (or thread) where staff handle their conversation.
+type Ticket struct {
+	UserID       string
+	UserName     string // User's Discord tag when the ticket was opened
+	GuildID      string
+	ChannelID    string
+	Department   string // Department ID, empty for the default department
+	Status       TicketStatus
+	ClaimedBy    string // User ID of the staff member who claimed the ticket
+	OpenedBy     string // User ID of the staff member who opened the ticket with /contact, empty if the user opened it
+	OpenedAt     time.Time
+	LastActivity time.Time // When a message was last relayed in either direction
+	Responded    bool      // Whether staff have replied to the user yet
+}
+
+// StaffInitiated reports whether staff opened the ticket rather than the user.
+func (t *Ticket) StaffInitiated() bool {
+	return t.OpenedBy != ""
+}
+
+// ticketStore tracks open tickets. Handlers run concurrently, so every access goes through the
+// lock and lookups hand out copies; changes go through update.
+type ticketStore struct {
+	mu      sync.RWMutex
+	byUser  map[string]*Ticket // UserID -> Ticket
+	opening map[string]bool    // Users whose ticket is being created
+}
+
+func newTicketStore() *ticketStore {
+	return &ticketStore{byUser: make(map[string]*Ticket), opening: make(map[string]bool)}
+}
+
+// reserve claims the right to open a ticket for the user. It fails if the user already has
+// a ticket, which is returned, or if another ticket is being opened for them, in which case
+// the returned ticket is nil. A successful reservation is ended with release.
+func (ts *ticketStore) reserve(userID string) (*Ticket, bool) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if t, ok := ts.byUser[userID]; ok {
+		c := *t
+		return &c, false
+	}
+	if ts.opening[userID] {
+		return nil, false
+	}
+	ts.opening[userID] = true
+	return nil, true
+}
+
+// release ends a reservation, whether or not the ticket was added.
+func (ts *ticketStore) release(userID string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	delete(ts.opening, userID)
+}
+
+// forUser returns the open ticket for a user, if any.
+func (ts *ticketStore) forUser(userID string) (*Ticket, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	t, ok := ts.byUser[userID]
+	if !ok {
+		return nil, false
+	}
+	c := *t
+	return &c, true
+}
+
+// forChannel returns the open ticket handled in the given channel, if any.
+func (ts *ticketStore) forChannel(channelID string) (*Ticket, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	for _, t := range ts.byUser {
+		if t.ChannelID == channelID {
+			c := *t
+			return &c, true
+		}
+	}
+	return nil, false
+}
+
+func (ts *ticketStore) add(t *Ticket) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	c := *t
+	ts.byUser[t.UserID] = &c
+}
+
+// update applies fn to the ticket handled in the given channel and returns the updated copy.
+func (ts *ticketStore) update(channelID string, fn func(t *Ticket)) (*Ticket, bool) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	for _, t := range ts.byUser {
+		if t.ChannelID == channelID {
+			fn(t)
+			c := *t
+			return &c, true
+		}
+	}
+	return nil, false
+}
+
+// all returns every open ticket, oldest first.
+func (ts *ticketStore) all() []*Ticket {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	out := make([]*Ticket, 0, len(ts.byUser))
+	for _, t := range ts.byUser {
+		c := *t
+		out = append(out, &c)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].OpenedAt.Before(out[b].OpenedAt) })
+	return out
+}
+
+// removeChannel drops the ticket handled in the given channel and returns it.
+func (ts *ticketStore) removeChannel(channelID string) (*Ticket, bool) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	for uid, t := range ts.byUser {
+		if t.ChannelID == channelID {
+			delete(ts.byUser, uid)
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// ping reports the number of open tickets, or false if the store's lock can't be taken
+// within the timeout (a stuck handler is holding it).
+func (ts *ticketStore) ping(timeout time.Duration) (int, bool) {
+	result := make(chan int, 1)
+	go func() {
+		ts.mu.RLock()
+		defer ts.mu.RUnlock()
+		result <- len(ts.byUser)
+	}()
+	select {
+	case n := <-result:
+		return n, true
+	case <-time.After(timeout):
+		return 0, false
+	}
+}
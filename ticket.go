@@ -1,19 +1,30 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 )
 
-// createNewTicket creates a new text channel for the ticket in the ModMail category.
-func createNewTicket(s *discordgo.Session, user *discordgo.User) (string, error) {
-    if cfg.ModMailCategoryID == "" || cfg.StaffRoleID == "" {
-        return "", fmt.Errorf("modmail configuration not complete")
-    }
+// createNewTicket opens a ticket for the user in the given guild using the guild's ticket
+// backend (a channel in the department's category, or a thread) and registers it as the
+// user's active ticket. openedBy is the staff member for tickets opened with /contact and
+// nil when the user opened the ticket themselves. If the user already has a ticket, it is
+// returned with errTicketExists; while another one is still being opened the ticket is nil.
+func createNewTicket(s *discordgo.Session, guildID string, user *discordgo.User, dept Department, openedBy *discordgo.User) (*Ticket, error) {
+	gc := cfg.guild(guildID)
+	if gc == nil || dept.StaffRoleID == "" {
+		return nil, fmt.Errorf("modmail configuration not complete for department %q", dept.Name)
+	}
+	if existing, ok := activeTickets.reserve(user.ID); !ok {
+		return existing, errTicketExists
+	}
+	defer activeTickets.release(user.ID)
     
 	channelName := fmt.Sprintf("%s-ticket", strings.ToLower(user.Username))
 	if len(channelName) > 100 { 
@@ -26,52 +37,186 @@ func createNewTicket(s *discordgo.Session, user *discordgo.User) (string, error)
         createdAt = time.Now() // Fallback if ID is invalid
     }
 
-
-	permissionOverwrites := []*discordgo.PermissionOverwrite{
-		{
-			ID:   cfg.GuildID, // @everyone role
-			Type: discordgo.PermissionOverwriteTypeRole,
-			Deny: discordgo.PermissionViewChannel,
-		},
-		{
-			ID:   cfg.StaffRoleID,
-			Type: discordgo.PermissionOverwriteTypeRole,
-			Allow: discordgo.PermissionViewChannel | 
-				   discordgo.PermissionSendMessages | 
-				   discordgo.PermissionReadMessageHistory,
-		},
-	}
-
-	ch, err := s.GuildChannelCreateComplex(cfg.GuildID, discordgo.GuildChannelCreateData{
-		Name:                 channelName,
-		Type:                 discordgo.ChannelTypeGuildText,
-		ParentID:             cfg.ModMailCategoryID,
-		Topic:                fmt.Sprintf("ModMail ticket for %s (%s)", user.String(), user.ID),
-		PermissionOverwrites: permissionOverwrites,
-	})
-
-	if err != nil {
-		return "", err
-	}
-
-	// Send an initial message in the ticket channel
-	s.ChannelMessageSendEmbed(ch.ID, &discordgo.MessageEmbed{
+	// Initial message posted in the ticket channel or thread
+	intro := &discordgo.MessageEmbed{
 		Title:       "🚨 New ModMail Ticket Opened",
 		Description: fmt.Sprintf("A new support ticket has been opened by **%s**.", user.String()),
 		Fields: []*discordgo.MessageEmbedField{
 			{Name: "User ID", Value: user.ID, Inline: true},
             // FIX: Use the extracted timestamp
 			{Name: "Joined Discord", Value: createdAt.Format("2 Jan 2006"), Inline: true},
+			{Name: "Department", Value: dept.Name, Inline: true},
 		},
 		Color: 0x00FF00, // Green
 		Timestamp: time.Now().Format(time.RFC3339),
+	}
+	if openedBy != nil {
+		intro.Description = fmt.Sprintf("**%s** opened a support ticket with **%s**.", openedBy.String(), user.String())
+		intro.Fields = append(intro.Fields, &discordgo.MessageEmbedField{Name: "Opened By", Value: openedBy.String(), Inline: true})
+	}
+
+	channelID, err := backendFor(gc).open(s, guildID, channelName, user, dept, intro)
+	if err != nil {
+		return nil, err
+	}
+
+	ticket := &Ticket{UserID: user.ID, GuildID: guildID, ChannelID: channelID, Department: dept.ID, Status: StatusOpen, OpenedAt: time.Now()}
+	ticket.UserName = user.String()
+	ticket.LastActivity = ticket.OpenedAt
+	if openedBy != nil {
+		ticket.OpenedBy = openedBy.ID
+	}
+	activeTickets.add(ticket)
+	publish(s, TicketOpened{Ticket: *ticket, User: user, OpenedBy: openedBy})
+	return ticket, nil
+}
+
+// setTicketStatus records a ticket's new status and reflects it in the guild's ticket backend.
+// It returns the updated ticket, if the channel has one.
+func setTicketStatus(s *discordgo.Session, channelID string, status TicketStatus, claimedBy string) (*Ticket, bool) {
+	ticket, ok := activeTickets.update(channelID, func(t *Ticket) {
+		t.Status = status
+		if claimedBy != "" {
+			t.ClaimedBy = claimedBy
+		}
 	})
+	if !ok {
+		return nil, false
+	}
+	if gc := cfg.guild(ticket.GuildID); gc != nil {
+		if err := backendFor(gc).setStatus(s, ticket, status); err != nil {
+			ticketLog(ticket).Error("Error updating ticket status", "status", status, "err", err)
+		}
+	}
+	return ticket, true
+}
+
+// errNoTicket is returned for actions on a channel without an open ticket.
+var errNoTicket = errors.New("no open ticket in this channel")
+
+// errTicketExists is returned when opening a ticket for a user who has one already.
+var errTicketExists = errors.New("user already has an open ticket")
+
+// Discord refuses to add more than this many channels to one category.
+const maxCategoryChannels = 50
+
+// overflowMu serializes overflow category creation so concurrent ticket opens don't each
+// create one.
+var overflowMu sync.Mutex
+
+// pickTicketCategory returns the first of the department's categories with room for another
+// channel, creating a numbered overflow category when all are full and the guild allows it.
+// Categories in full are skipped: Discord said so even though the cached count disagreed.
+func pickTicketCategory(s *discordgo.Session, guildID string, dept Department, full map[string]bool) (string, error) {
+	if categoryID, ok := firstCategoryWithRoom(s, guildID, dept, full); ok {
+		return categoryID, nil
+	}
+
+	overflowMu.Lock()
+	defer overflowMu.Unlock()
+	gc := cfg.guild(guildID)
+	if gc == nil {
+		return "", fmt.Errorf("guild %s is not configured", guildID)
+	}
+	// Another ticket may have created an overflow category while we waited.
+	dept.OverflowCategoryIDs = gc.department(dept.ID).OverflowCategoryIDs
+	if categoryID, ok := firstCategoryWithRoom(s, guildID, dept, full); ok {
+		return categoryID, nil
+	}
+	categories := append([]string{dept.CategoryID}, dept.OverflowCategoryIDs...)
+	if !gc.AutoCreateOverflow {
+		return "", fmt.Errorf("all %d ticket categories for department %q are full", len(categories), dept.Name)
+	}
+	// A new category could not be recorded over an environment override, so every ticket
+	// would create another one.
+	for _, field := range []string{"OverflowCategoryIDs", "Departments"} {
+		if name := cfg.pinnedBy(guildID, field); name != "" {
+			return "", fmt.Errorf("all %d ticket categories for department %q are full and %s pins the overflow categories", len(categories), dept.Name, name)
+		}
+	}
 
-	return ch.ID, nil
+	// Copy the main category's permissions so the overflow looks the same to staff.
+	name := fmt.Sprintf("ModMail %d", len(categories)+1)
+	var overwrites []*discordgo.PermissionOverwrite
+	var position int
+	if primary, err := s.State.Channel(dept.CategoryID); err == nil {
+		name = fmt.Sprintf("%s %d", primary.Name, len(categories)+1)
+		overwrites = primary.PermissionOverwrites
+		position = primary.Position + len(categories)
+	}
+
+	category, err := s.GuildChannelCreateComplex(guildID, discordgo.GuildChannelCreateData{
+		Name:                 name,
+		Type:                 discordgo.ChannelTypeGuildCategory,
+		PermissionOverwrites: overwrites,
+		Position:             position,
+	})
+	if err != nil {
+		return "", fmt.Errorf("creating overflow category: %w", err)
+	}
+
+	before, _, _ := cfg.updateGuild(guildID, func(gc *GuildConfig) error {
+		gc.addOverflowCategory(dept.ID, category.ID)
+		return nil
+	})
+	source := "Automatic overflow category " + category.Name
+	auditCreated(s, guildID, botActor(s), source, []string{"overflow category <#" + category.ID + ">"},
+		map[string]string{"category": category.ID}, overwrites)
+	saveGuildConfig(s, guildID, before, nil, source)
+	slog.Info("Created overflow category", "guild_id", guildID, "category_id", category.ID, "name", category.Name)
+	return category.ID, nil
+}
+
+// firstCategoryWithRoom returns the first of the department's categories that is not in full
+// and has fewer than the maximum number of cached channels. Without a cached guild there is
+// nothing to count, so Discord decides.
+func firstCategoryWithRoom(s *discordgo.Session, guildID string, dept Department, full map[string]bool) (string, bool) {
+	guild, _ := s.State.Guild(guildID)
+	s.State.RLock()
+	defer s.State.RUnlock()
+	for _, categoryID := range append([]string{dept.CategoryID}, dept.OverflowCategoryIDs...) {
+		if full[categoryID] {
+			continue
+		}
+		if guild == nil || countCategoryChannels(guild, categoryID) < maxCategoryChannels {
+			return categoryID, true
+		}
+	}
+	return "", false
+}
+
+// isCategoryFull reports whether Discord refused a channel because its category already
+// holds the maximum number of channels.
+func isCategoryFull(err error) bool {
+	var restErr *discordgo.RESTError
+	return errors.As(err, &restErr) && restErr.Message != nil &&
+		restErr.Message.Code == discordgo.ErrCodeInvalidFormBody &&
+		strings.Contains(string(restErr.ResponseBody), "CHANNEL_PARENT_MAX_CHANNELS")
+}
+
+// countCategoryChannels counts the cached channels whose parent is the given category.
+func countCategoryChannels(guild *discordgo.Guild, categoryID string) int {
+	n := 0
+	for _, ch := range guild.Channels {
+		if ch.ParentID == categoryID {
+			n++
+		}
+	}
+	return n
+}
+
+// ticketStaffRoles lists the roles that get access to a department's ticket channels:
+// the department's own role plus the guild's staff role, which can see every department.
+func ticketStaffRoles(gc *GuildConfig, dept Department) []string {
+	roles := []string{dept.StaffRoleID}
+	if gc != nil && gc.StaffRoleID != "" && gc.StaffRoleID != dept.StaffRoleID {
+		roles = append(roles, gc.StaffRoleID)
+	}
+	return roles
 }
 
 // forwardUserMessage forwards a message from the user's DM to the ticket channel as an embed.
-func forwardUserMessage(s *discordgo.Session, m *discordgo.MessageCreate, ticketChannelID string) {
+func forwardUserMessage(s *discordgo.Session, m *discordgo.MessageCreate, ticket *Ticket) {
 	embed := createMessageEmbed(m.Author, m.Content, "User Message", 0x00BFFF) // Deep Sky Blue
 
 	// Check for attachments (images/files/links)
@@ -88,42 +233,99 @@ func forwardUserMessage(s *discordgo.Session, m *discordgo.MessageCreate, ticket
 		}
 	}
 	
-	s.ChannelMessageSendEmbed(ticketChannelID, embed)
+	if _, err := s.ChannelMessageSendEmbed(ticket.ChannelID, embed); err != nil {
+		ticketLog(ticket).Error("Error relaying message to ticket", "channel_id", m.ChannelID, "message_id", m.ID, "err", err)
+		recordRelayFailure("to_staff", err)
+		return
+	}
+	publish(s, MessageRelayed{Ticket: *ticket, Message: newTranscriptMessage(m.Author, false, m.Content, m.Attachments)})
 }
 
 // forwardStaffReply forwards a staff member's message from the ticket channel to the user's DM as an embed.
-func forwardStaffReply(s *discordgo.Session, m *discordgo.MessageCreate, userID string) {
-	embed := createMessageEmbed(m.Author, m.Content, "Staff Reply", 0xFF8C00) // Dark Orange
+func forwardStaffReply(s *discordgo.Session, m *discordgo.MessageCreate, ticket *Ticket) {
+	if err := sendStaffReply(s, ticket, m.Author, m.Content, m.Attachments); err != nil {
+		return
+	}
+	if err := s.MessageReactionAdd(m.ChannelID, m.ID, "✅"); err != nil {
+		ticketLog(ticket).Warn("Error reacting to relayed staff reply", "message_id", m.ID, "err", err)
+	}
+}
+
+// sendStaffReply DMs a staff reply to the ticket's user and records it in the transcript.
+// Failures are reported in the ticket channel as well as returned. Replies from Discord and
+// from the API both go through here.
+func sendStaffReply(s *discordgo.Session, ticket *Ticket, author *discordgo.User, content string, attachments []*discordgo.MessageAttachment) error {
+	embed := createMessageEmbed(author, content, "Staff Reply", 0xFF8C00) // Dark Orange
+	logger := ticketLog(ticket).With("staff_id", author.ID)
 
-	userChannel, err := s.UserChannelCreate(userID)
+	userChannel, err := s.UserChannelCreate(ticket.UserID)
 	if err != nil {
-		log.Printf("Error creating DM channel for user %s: %v", userID, err)
-		s.ChannelMessageSend(m.ChannelID, "⚠️ Could not DM the user. They may have DMs disabled.")
-		return
+		logger.Error("Error creating DM channel", "err", err)
+		recordRelayFailure("to_user", err)
+		sendMessage(s, logger, ticket.ChannelID, "⚠️ Could not DM the user. They may have DMs disabled.")
+		return err
 	}
-	
+
 	// Check for attachments (images/files/links)
-	if len(m.Attachments) > 0 {
-		attachment := m.Attachments[0]
+	if len(attachments) > 0 {
+		attachment := attachments[0]
 		if strings.Contains(attachment.ContentType, "image") {
 			embed.Image = &discordgo.MessageEmbedImage{URL: attachment.URL}
 		} else {
 			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
-				Name:  "Attachment",
-				Value: fmt.Sprintf("[%s](%s)", attachment.Filename, attachment.URL),
+				Name:   "Attachment",
+				Value:  fmt.Sprintf("[%s](%s)", attachment.Filename, attachment.URL),
 				Inline: false,
 			})
 		}
 	}
 
-	_, err = s.ChannelMessageSendEmbed(userChannel.ID, embed)
+	if _, err := s.ChannelMessageSendEmbed(userChannel.ID, embed); err != nil {
+		logger.Error("Error sending staff reply", "channel_id", userChannel.ID, "err", err)
+		recordRelayFailure("to_user", err)
+		sendMessage(s, logger, ticket.ChannelID, "⚠️ Could not send the message to the user.")
+		return err
+	}
+
+	publish(s, MessageRelayed{Ticket: *ticket, Message: newTranscriptMessage(author, true, content, attachments)})
+	return nil
+}
+
+// closeTicket tells the user their ticket was closed, marks it closed and archives its
+// transcript. /close and the API both go through here.
+func closeTicket(s *discordgo.Session, channelID string, closer *discordgo.User) error {
+	ticket, ok := activeTickets.forChannel(channelID)
+	if !ok {
+		return errNoTicket
+	}
+
+	dmChannel, err := s.UserChannelCreate(ticket.UserID)
+	if err == nil {
+		_, err = s.ChannelMessageSend(dmChannel.ID, fmt.Sprintf(
+			"🔒 Your support ticket has been closed by **%s**. It may be reopened if needed.", closer.String(),
+		))
+	}
 	if err != nil {
-		log.Printf("Error sending staff reply to user %s: %v", userID, err)
-		s.ChannelMessageSend(m.ChannelID, "⚠️ Could not send the message to the user.")
-		return
+		ticketLog(ticket).Error("Error notifying user that their ticket was closed", "err", err)
 	}
 
-	s.MessageReactionAdd(m.ChannelID, m.ID, "✅")
+	setTicketStatus(s, channelID, StatusClosed, "")
+	endTicket(s, channelID, closer, "Closed by staff: "+closer.String(), false)
+	return nil
+}
+
+// recordFirstResponse observes the time to the first staff reply on tickets users opened.
+func recordFirstResponse(channelID string) {
+	var waited time.Duration
+	activeTickets.update(channelID, func(t *Ticket) {
+		if !t.Responded && !t.StaffInitiated() && !t.OpenedAt.IsZero() {
+			waited = time.Since(t.OpenedAt)
+		}
+		t.Responded = true
+	})
+	if waited > 0 {
+		metricFirstResponse.observe(waited.Seconds())
+	}
 }
 
 // createMessageEmbed is a helper to build a consistent message embed structure.
@@ -144,31 +346,50 @@ func createMessageEmbed(author *discordgo.User, content string, title string, co
 	return embed
 }
 
-// logTranscript sends a log of the ticket to the log channel.
-func logTranscript(s *discordgo.Session, channelID string, user *discordgo.User, reason string) {
-	if cfg.LogChannelID == "" {
+// endTicket removes a closed or deleted ticket from the active tickets and publishes
+// TicketClosed, which saves its transcript and logs it.
+func endTicket(s *discordgo.Session, channelID string, closer *discordgo.User, reason string, deleted bool) {
+	ticket, ok := activeTickets.removeChannel(channelID)
+	if !ok {
+		return
+	}
+	ticket.Status = StatusClosed
+
+	user, err := s.User(ticket.UserID)
+	if err != nil {
+		ticketLog(ticket).Warn("Error fetching user for closed ticket", "err", err)
+		user = &discordgo.User{ID: ticket.UserID, Username: ticket.UserName}
+	}
+	publish(s, TicketClosed{Ticket: *ticket, User: user, By: closer, Reason: reason, Deleted: deleted})
+}
+
+// postTicketLog sends a log of closed and deleted tickets to their department's log channel.
+func postTicketLog(s *discordgo.Session, e TicketEvent) {
+	closed, ok := e.(TicketClosed)
+	if !ok {
+		return
+	}
+	gc := cfg.guild(closed.Ticket.GuildID)
+	if gc == nil {
+		return
+	}
+	dept := gc.department(closed.Ticket.Department)
+	if dept.LogChannelID == "" {
 		return
 	}
 
 	logEmbed := &discordgo.MessageEmbed{
 		Title:       "🔒 Ticket Closed/Deleted",
-		Description: fmt.Sprintf("Ticket for **%s** has been logged.", user.String()),
+		Description: fmt.Sprintf("Ticket for **%s** has been logged.", closed.User.String()),
 		Fields: []*discordgo.MessageEmbedField{
-			{Name: "User", Value: user.String(), Inline: true},
-			{Name: "Channel ID", Value: channelID, Inline: true},
-			{Name: "Reason", Value: reason, Inline: false},
+			{Name: "User", Value: closed.User.String(), Inline: true},
+			{Name: "Channel ID", Value: closed.Ticket.ChannelID, Inline: true},
+			{Name: "Department", Value: dept.Name, Inline: true},
+			{Name: "Reason", Value: closed.Reason, Inline: false},
 		},
 		Color: 0x808080, // Grey
 		Timestamp: time.Now().Format(time.RFC3339),
 	}
 
-	s.ChannelMessageSendEmbed(cfg.LogChannelID, logEmbed)
-
-	// Remove from active tickets map
-	for uid, cid := range activeTickets {
-		if cid == channelID {
-			delete(activeTickets, uid)
-			break
-		}
-	}
+	sendEmbed(s, ticketLog(&closed.Ticket), dept.LogChannelID, logEmbed)
 }
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// transcriptMessage is one message relayed in a ticket.
+type transcriptMessage struct {
+	Time        time.Time
+	AuthorID    string
+	Author      string
+	FromStaff   bool
+	Content     string
+	Attachments []string `json:",omitempty"` // URLs
+}
+
+// transcript is the saved record of a closed ticket.
+type transcript struct {
+	Ticket   Ticket
+	ClosedAt time.Time
+	Reason   string
+	Messages []transcriptMessage
+}
+
+// ticketMessages collects the messages of open tickets, keyed by ticket channel ID, until
+// they are archived on close.
+var ticketMessages = struct {
+	sync.Mutex
+	byChannel map[string][]transcriptMessage
+}{byChannel: make(map[string][]transcriptMessage)}
+
+// newTranscriptMessage builds the transcript entry for a relayed message.
+func newTranscriptMessage(author *discordgo.User, fromStaff bool, content string, attachments []*discordgo.MessageAttachment) transcriptMessage {
+	msg := transcriptMessage{Time: time.Now(), AuthorID: author.ID, Author: author.String(), FromStaff: fromStaff, Content: content}
+	for _, a := range attachments {
+		msg.Attachments = append(msg.Attachments, a.URL)
+	}
+	return msg
+}
+
+// recordTranscriptEvent adds relayed messages to the ticket's transcript, bumping its last
+// activity time, and archives the transcript once the ticket is closed.
+func recordTranscriptEvent(s *discordgo.Session, e TicketEvent) {
+	switch e := e.(type) {
+	case MessageRelayed:
+		ticketMessages.Lock()
+		ticketMessages.byChannel[e.Ticket.ChannelID] = append(ticketMessages.byChannel[e.Ticket.ChannelID], e.Message)
+		ticketMessages.Unlock()
+		activeTickets.update(e.Ticket.ChannelID, func(t *Ticket) { t.LastActivity = e.Message.Time })
+	case TicketClosed:
+		archiveTranscript(&e.Ticket, e.Reason)
+	}
+}
+
+// openTicketMessages returns a copy of an open ticket's messages so far.
+func openTicketMessages(channelID string) []transcriptMessage {
+	ticketMessages.Lock()
+	defer ticketMessages.Unlock()
+	return append([]transcriptMessage(nil), ticketMessages.byChannel[channelID]...)
+}
+
+// archiveTranscript writes a closed ticket and its messages to the transcript directory.
+func archiveTranscript(ticket *Ticket, reason string) {
+	ticketMessages.Lock()
+	messages := ticketMessages.byChannel[ticket.ChannelID]
+	delete(ticketMessages.byChannel, ticket.ChannelID)
+	ticketMessages.Unlock()
+
+	data, err := json.MarshalIndent(transcript{Ticket: *ticket, ClosedAt: time.Now(), Reason: reason, Messages: messages}, "", "  ")
+	if err != nil {
+		ticketLog(ticket).Error("Error marshalling transcript", "err", err)
+		return
+	}
+	if err := os.MkdirAll(transcriptDir(), 0700); err != nil {
+		ticketLog(ticket).Error("Error creating transcript directory", "dir", transcriptDir(), "err", err)
+		return
+	}
+	if err := os.WriteFile(transcriptPath(ticket.ChannelID), data, 0600); err != nil {
+		ticketLog(ticket).Error("Error saving transcript", "err", err)
+	}
+}
+
+// transcriptDir is MODMAIL_TRANSCRIPT_DIR, or "transcripts" in the working directory.
+func transcriptDir() string {
+	if dir := os.Getenv("MODMAIL_TRANSCRIPT_DIR"); dir != "" {
+		return dir
+	}
+	return "transcripts"
+}
+
+func transcriptPath(channelID string) string {
+	return filepath.Join(transcriptDir(), channelID+".json")
+}
+
+var snowflakePattern = regexp.MustCompile(`^\d+$`)
+
+// loadTranscript reads the transcript of a closed ticket by its channel ID.
+func loadTranscript(channelID string) (transcript, error) {
+	var t transcript
+	if !snowflakePattern.MatchString(channelID) {
+		return t, fmt.Errorf("invalid ticket ID %q", channelID)
+	}
+	data, err := os.ReadFile(transcriptPath(channelID))
+	if err != nil {
+		return t, err
+	}
+	err = json.Unmarshal(data, &t)
+	return t, err
+}
+
+// loadTranscripts reads every saved transcript, most recently closed first.
+func loadTranscripts() ([]transcript, error) {
+	entries, err := os.ReadDir(transcriptDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var out []transcript
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || e.IsDir() {
+			continue
+		}
+		t, err := loadTranscript(id)
+		if err != nil {
+			slog.Warn("Skipping unreadable transcript", "file", e.Name(), "err", err)
+			continue
+		}
+		out = append(out, t)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].ClosedAt.After(out[b].ClosedAt) })
+	return out, nil
+}
+
+// matches reports whether a search query appears in the ticket's user, IDs or messages.
+func (t transcript) matches(query string) bool {
+	query = strings.ToLower(query)
+	fields := []string{t.Ticket.UserID, t.Ticket.UserName, t.Ticket.ChannelID, t.Ticket.Department, t.Reason}
+	for _, m := range t.Messages {
+		fields = append(fields, m.Author, m.Content)
+	}
+	for _, f := range fields {
+		if strings.Contains(strings.ToLower(f), query) {
+			return true
+		}
+	}
+	return false
+}
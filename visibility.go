@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Human-readable names for the permissions used as command defaults.
+var permissionNames = map[int64]string{
+	discordgo.PermissionManageServer:   "Manage Server",
+	discordgo.PermissionManageMessages: "Manage Messages",
+}
+
+// handleCommandsReportCommand shows, for each registered command, which roles can see it in
+// the command picker and whether the roles ModMail relies on are among them.
+func handleCommandsReportCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	report, err := commandVisibilityReport(s, i.GuildID)
+	if err != nil {
+		interactionLog(i).Error("Error building command visibility report", "err", err)
+		respondEphemeral(s, i, "❌ Couldn't read the registered commands from Discord.")
+		return
+	}
+
+	respond(s, i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{{
+				Title:       "🔎 Command Visibility",
+				Description: "Roles that can see each command. Change this under **Server Settings → Integrations**.",
+				Fields:      report,
+				Color:       0x00BFFF, // Deep Sky Blue
+			}},
+			Flags: discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
+
+// commandVisibilityReport builds one embed field per command registered in the guild.
+func commandVisibilityReport(s *discordgo.Session, guildID string) ([]*discordgo.MessageEmbedField, error) {
+	registered, err := s.ApplicationCommands(s.State.User.ID, guildID)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := s.GuildRoles(guildID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(roles, func(a, b int) bool { return roles[a].Position > roles[b].Position })
+
+	// Overrides are keyed by command ID; an entry under the application ID applies to every
+	// command without its own overrides.
+	overrides := make(map[string]map[string]bool)
+	perms, err := s.GuildApplicationCommandsPermissions(s.State.User.ID, guildID)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range perms {
+		roleOverrides := make(map[string]bool)
+		for _, o := range p.Permissions {
+			if o.Type == discordgo.ApplicationCommandPermissionTypeRole {
+				roleOverrides[o.ID] = o.Permission
+			}
+		}
+		overrides[p.ID] = roleOverrides
+	}
+
+	gc := cfg.guild(guildID)
+	var fields []*discordgo.MessageEmbedField
+	for _, cmd := range registered {
+		cmdOverrides, ok := overrides[cmd.ID]
+		if !ok {
+			cmdOverrides = overrides[s.State.User.ID]
+		}
+
+		var visible []string
+		visibleIDs := make(map[string]bool)
+		for _, role := range roles {
+			if roleCanSeeCommand(role, cmd, cmdOverrides, guildID) {
+				visibleIDs[role.ID] = true
+				if role.ID == guildID {
+					visible = append(visible, "@everyone")
+				} else {
+					visible = append(visible, "<@&"+role.ID+">")
+				}
+			}
+		}
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "Minimum staff level: **%s**\n", gc.commandLevel(cmd.Name))
+		if len(cmdOverrides) > 0 {
+			b.WriteString("Visibility: server overrides\n")
+		} else if cmd.DefaultMemberPermissions != nil && *cmd.DefaultMemberPermissions != 0 {
+			fmt.Fprintf(&b, "Visibility: default (%s)\n", permissionName(*cmd.DefaultMemberPermissions))
+		} else {
+			b.WriteString("Visibility: everyone\n")
+		}
+		if visibleIDs[guildID] {
+			b.WriteString("Visible to: everyone")
+		} else if len(visible) == 0 {
+			b.WriteString("Visible to: administrators only")
+		} else {
+			b.WriteString("Visible to: " + strings.Join(visible, ", "))
+		}
+		if hidden := hiddenStaffRoles(gc, cmd.Name, visibleIDs); len(hidden) > 0 && !visibleIDs[guildID] {
+			b.WriteString("\n⚠️ Hidden from staff roles that may run it: " + strings.Join(hidden, ", "))
+		}
+
+		fields = append(fields, &discordgo.MessageEmbedField{Name: "/" + cmd.Name, Value: b.String()})
+		if len(fields) == 25 {
+			break
+		}
+	}
+	return fields, nil
+}
+
+// roleCanSeeCommand applies Discord's rules for a single role: administrators see everything,
+// a role override wins, then an @everyone override, then the command's default permissions.
+func roleCanSeeCommand(role *discordgo.Role, cmd *discordgo.ApplicationCommand, overrides map[string]bool, guildID string) bool {
+	if role.Permissions&discordgo.PermissionAdministrator != 0 {
+		return true
+	}
+	if allowed, ok := overrides[role.ID]; ok {
+		return allowed
+	}
+	if allowed, ok := overrides[guildID]; ok {
+		return allowed
+	}
+	if cmd.DefaultMemberPermissions == nil {
+		return true
+	}
+	required := *cmd.DefaultMemberPermissions
+	return required != 0 && role.Permissions&required == required
+}
+
+// hiddenStaffRoles lists configured staff roles whose level allows running the command but
+// who can't see it in the picker.
+func hiddenStaffRoles(gc *GuildConfig, command string, visible map[string]bool) []string {
+	if gc == nil {
+		return nil
+	}
+	required := gc.commandLevel(command)
+	if required == LevelNone {
+		return nil
+	}
+
+	roleLevels := make(map[string]StaffLevel)
+	if required <= LevelHelper {
+		if gc.StaffRoleID != "" {
+			roleLevels[gc.StaffRoleID] = LevelHelper
+		}
+		for _, d := range gc.Departments {
+			if d.StaffRoleID != "" {
+				roleLevels[d.StaffRoleID] = LevelHelper
+			}
+		}
+	}
+	for _, sr := range gc.StaffRoles {
+		roleLevels[sr.RoleID] = max(roleLevels[sr.RoleID], sr.Level)
+	}
+
+	var hidden []string
+	for roleID, level := range roleLevels {
+		if level >= required && !visible[roleID] {
+			hidden = append(hidden, "<@&"+roleID+">")
+		}
+	}
+	sort.Strings(hidden)
+	return hidden
+}
+
+func permissionName(p int64) string {
+	if name, ok := permissionNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("permissions %d", p)
+}
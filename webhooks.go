@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Ticket lifecycle events sent to outgoing webhooks.
+const (
+	eventTicketOpened   = "ticket.opened"
+	eventMessageRelayed = "ticket.message"
+	eventTicketClaimed  = "ticket.claimed"
+	eventTicketClosed   = "ticket.closed"
+	eventTicketDeleted  = "ticket.deleted"
+)
+
+var webhookEvents = []string{eventTicketOpened, eventMessageRelayed, eventTicketClaimed, eventTicketClosed, eventTicketDeleted}
+
+const (
+	maxWebhookAttempts = 5
+	webhookLogSize     = 100 // Deliveries kept for /modmail-webhooks
+)
+
+// webhookRetryBackoff is the wait before the first retry, doubled after each failed attempt.
+var webhookRetryBackoff = 2 * time.Second
+
+// Webhook is an outgoing HTTP endpoint that receives ticket events as signed JSON POSTs.
+type Webhook struct {
+	URL    string
+	Events []string // Events to send; empty sends all of them
+}
+
+// wants reports whether the webhook subscribes to an event.
+func (w Webhook) wants(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// validate reports a webhook URL or event name that could never be delivered.
+func (w Webhook) validate() error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook URL %q is not an http(s) URL", w.URL)
+	}
+	for _, e := range w.Events {
+		known := false
+		for _, k := range webhookEvents {
+			known = known || e == k
+		}
+		if !known {
+			return fmt.Errorf("webhook %s: unknown event %q", w.URL, e)
+		}
+	}
+	return nil
+}
+
+// webhookPayload is the JSON body POSTed for each event.
+type webhookPayload struct {
+	ID      string      `json:"id"` // Same on every retry, so receivers can drop duplicates
+	Event   string      `json:"event"`
+	Time    time.Time   `json:"time"`
+	Ticket  apiTicket   `json:"ticket"`
+	ActorID string      `json:"actor_id,omitempty"` // Staff member who claimed, closed or deleted the ticket
+	Reason  string      `json:"reason,omitempty"`
+	Message *apiMessage `json:"message,omitempty"`
+}
+
+// webhookDelivery is the outcome of sending one event to one webhook.
+type webhookDelivery struct {
+	ID         string
+	GuildID    string
+	URL        string
+	Event      string
+	Time       time.Time // When the last attempt finished
+	Attempts   int
+	StatusCode int
+	Error      string
+	Delivered  bool
+}
+
+// webhookLog keeps the most recent deliveries in memory for admins to review.
+var webhookLog = struct {
+	sync.Mutex
+	entries []webhookDelivery
+}{}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+var warnUnsignedWebhooks sync.Once
+
+// sendTicketWebhooks forwards ticket events to the guild's outgoing webhooks.
+func sendTicketWebhooks(s *discordgo.Session, e TicketEvent) {
+	switch e := e.(type) {
+	case TicketOpened:
+		openedBy := ""
+		if e.OpenedBy != nil {
+			openedBy = e.OpenedBy.ID
+		}
+		fireWebhooks(eventTicketOpened, e.Ticket, openedBy, "", nil)
+	case MessageRelayed:
+		fireWebhooks(eventMessageRelayed, e.Ticket, "", "", &e.Message)
+	case TicketClaimed:
+		fireWebhooks(eventTicketClaimed, e.Ticket, e.By.ID, "", nil)
+	case TicketClosed:
+		event := eventTicketClosed
+		if e.Deleted {
+			event = eventTicketDeleted
+		}
+		fireWebhooks(event, e.Ticket, e.By.ID, e.Reason, nil)
+	}
+}
+
+// fireWebhooks sends an event to every webhook of the ticket's guild that subscribes to it.
+// Deliveries run in the background; handlers never wait on them.
+func fireWebhooks(event string, ticket Ticket, actorID, reason string, msg *transcriptMessage) {
+	gc := cfg.guild(ticket.GuildID)
+	if gc == nil || len(gc.Webhooks) == 0 {
+		return
+	}
+	secret := cfg.Secrets.WebhookSecret.reveal()
+	if secret == "" {
+		warnUnsignedWebhooks.Do(func() {
+			slog.Warn("Outgoing webhooks disabled; set MODMAIL_WEBHOOK_SECRET to sign and send them.")
+		})
+		return
+	}
+
+	payload := webhookPayload{ID: newDeliveryID(), Event: event, Time: time.Now(), Ticket: newAPITicket(ticket), ActorID: actorID, Reason: reason}
+	if ticket.Status == StatusClosed {
+		payload.Ticket.ClosedAt = &payload.Time
+		payload.Ticket.CloseReason = reason
+	}
+	if msg != nil {
+		converted := newAPIMessages([]transcriptMessage{*msg})[0]
+		payload.Message = &converted
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		ticketLog(&ticket).Error("Error marshalling webhook payload", "event", event, "err", err)
+		return
+	}
+
+	for _, hook := range gc.Webhooks {
+		if hook.wants(event) {
+			go deliverWebhook(ticket.GuildID, hook.URL, payload, body, secret)
+		}
+	}
+}
+
+// deliverWebhook POSTs a payload, retrying with exponential backoff on network errors,
+// 5xx, 408 and 429 responses. Other 4xx responses are not retried.
+func deliverWebhook(guildID, target string, payload webhookPayload, body []byte, secret string) {
+	defer recoverPanic(slog.With("guild_id", guildID, "url", target, "event", payload.Event), "webhook delivery")
+	signature := signWebhook(body, secret)
+
+	delivery := webhookDelivery{ID: payload.ID, GuildID: guildID, URL: target, Event: payload.Event}
+	backoff := webhookRetryBackoff
+	for delivery.Attempts < maxWebhookAttempts {
+		if delivery.Attempts > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		delivery.Attempts++
+
+		retry := true
+		delivery.StatusCode, delivery.Error = 0, ""
+		req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("User-Agent", "ModMail-Webhook")
+			req.Header.Set("X-ModMail-Event", payload.Event)
+			req.Header.Set("X-ModMail-Delivery", payload.ID)
+			req.Header.Set("X-ModMail-Signature", signature)
+			var resp *http.Response
+			if resp, err = webhookClient.Do(req); err == nil {
+				resp.Body.Close()
+				delivery.StatusCode = resp.StatusCode
+				delivery.Delivered = resp.StatusCode < 300
+				retry = retryableStatus(resp.StatusCode)
+			}
+		}
+		if delivery.Delivered {
+			break
+		}
+		if err != nil {
+			delivery.Error = err.Error()
+		} else {
+			delivery.Error = http.StatusText(delivery.StatusCode)
+		}
+		slog.Warn("Webhook delivery failed", "ticket_id", payload.Ticket.ID, "user_id", payload.Ticket.UserID, "guild_id", guildID,
+			"event", payload.Event, "delivery_id", payload.ID, "url", target, "attempt", delivery.Attempts, "err", delivery.Error)
+		if !retry {
+			break
+		}
+	}
+
+	delivery.Time = time.Now()
+	webhookLog.Lock()
+	webhookLog.entries = append(webhookLog.entries, delivery)
+	if len(webhookLog.entries) > webhookLogSize {
+		webhookLog.entries = webhookLog.entries[len(webhookLog.entries)-webhookLogSize:]
+	}
+	webhookLog.Unlock()
+}
+
+// signWebhook returns the X-ModMail-Signature header for a body: its HMAC-SHA256 under the
+// webhook secret, hex-encoded and prefixed with "sha256=".
+func signWebhook(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryableStatus reports whether a failed delivery with this response status is worth
+// retrying: server errors, timeouts and rate limits are; other client errors are not.
+func retryableStatus(code int) bool {
+	return code >= 500 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
+}
+
+func newDeliveryID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// guildDeliveries returns the guild's logged deliveries, newest first.
+func guildDeliveries(guildID string) []webhookDelivery {
+	webhookLog.Lock()
+	defer webhookLog.Unlock()
+	var out []webhookDelivery
+	for i := len(webhookLog.entries) - 1; i >= 0; i-- {
+		if webhookLog.entries[i].GuildID == guildID {
+			out = append(out, webhookLog.entries[i])
+		}
+	}
+	return out
+}
+
+// handleWebhooksCommand shows the guild's webhooks and their recent deliveries.
+func handleWebhooksCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	gc := cfg.guild(i.GuildID)
+	if gc == nil || len(gc.Webhooks) == 0 {
+		respondEphemeral(s, i, fmt.Sprintf("No webhooks are configured. Add them under `Webhooks` for this server in %s.", configFileName))
+		return
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:     "🔗 ModMail Webhooks",
+		Color:     0x5865F2, // Blurple
+		Timestamp: time.Now().Format(time.RFC3339),
+	}
+	if cfg.Secrets.WebhookSecret == "" {
+		embed.Description = "⚠️ MODMAIL_WEBHOOK_SECRET is not set, so nothing is being sent."
+	}
+	for _, hook := range gc.Webhooks {
+		events := "all events"
+		if len(hook.Events) > 0 {
+			events = strings.Join(hook.Events, ", ")
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: truncate(hook.URL, 256), Value: events})
+	}
+
+	var lines []string
+	for _, d := range guildDeliveries(i.GuildID) {
+		status := "✅"
+		if !d.Delivered {
+			status = "❌"
+		}
+		line := fmt.Sprintf("%s <t:%d:R> `%s` → %s", status, d.Time.Unix(), d.Event, d.URL)
+		if !d.Delivered {
+			line += fmt.Sprintf(" (%s after %d attempts)", d.Error, d.Attempts)
+		}
+		lines = append(lines, line)
+		if len(lines) == 15 {
+			break
+		}
+	}
+	recent := "No deliveries since the bot started."
+	if len(lines) > 0 {
+		recent = truncate(strings.Join(lines, "\n"), 1024)
+	}
+	embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Recent Deliveries", Value: recent})
+
+	respond(s, i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{embed},
+			Flags:  discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
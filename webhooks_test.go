@@ -0,0 +1,112 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSignWebhook(t *testing.T) {
+	// The example from GitHub's webhook documentation, which uses the same scheme.
+	got := signWebhook([]byte("Hello, World!"), "It's a Secret to Everybody")
+	want := "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"
+	if got != want {
+		t.Errorf("signWebhook = %q, want %q", got, want)
+	}
+}
+
+func TestRetryableStatus(t *testing.T) {
+	tests := map[int]bool{
+		http.StatusBadRequest:          false,
+		http.StatusUnauthorized:        false,
+		http.StatusNotFound:            false,
+		http.StatusGone:                false,
+		http.StatusRequestTimeout:      true,
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusBadGateway:          true,
+		http.StatusServiceUnavailable:  true,
+	}
+	for code, want := range tests {
+		if got := retryableStatus(code); got != want {
+			t.Errorf("retryableStatus(%d) = %v, want %v", code, got, want)
+		}
+	}
+}
+
+// lastDelivery returns the most recently logged delivery to the guild.
+func lastDelivery(t *testing.T, guildID string) webhookDelivery {
+	t.Helper()
+	deliveries := guildDeliveries(guildID)
+	if len(deliveries) == 0 {
+		t.Fatal("no delivery was logged")
+	}
+	return deliveries[0]
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	defer func(backoff time.Duration) { webhookRetryBackoff = backoff }(webhookRetryBackoff)
+	webhookRetryBackoff = time.Millisecond
+
+	tests := []struct {
+		name      string
+		statuses  []int // Responses in order; the last one repeats
+		attempts  int
+		delivered bool
+	}{
+		{"delivered", []int{http.StatusNoContent}, 1, true},
+		{"retried until delivered", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}, 3, true},
+		{"client error not retried", []int{http.StatusBadRequest}, 1, false},
+		{"gives up", []int{http.StatusInternalServerError}, maxWebhookAttempts, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := []byte(`{"id":"abc","event":"ticket.opened"}`)
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(calls.Add(1))
+				got, _ := io.ReadAll(r.Body)
+				if string(got) != string(body) {
+					t.Errorf("body = %s, want %s", got, body)
+				}
+				if sig := r.Header.Get("X-ModMail-Signature"); sig != signWebhook(got, "s3cret") {
+					t.Errorf("X-ModMail-Signature = %q does not match the body", sig)
+				}
+				if id := r.Header.Get("X-ModMail-Delivery"); id != "abc" {
+					t.Errorf("X-ModMail-Delivery = %q, want the payload ID on every attempt", id)
+				}
+				w.WriteHeader(tt.statuses[min(n, len(tt.statuses))-1])
+			}))
+			defer srv.Close()
+
+			guildID := "guild-" + tt.name
+			deliverWebhook(guildID, srv.URL, webhookPayload{ID: "abc", Event: eventTicketOpened}, body, "s3cret")
+
+			d := lastDelivery(t, guildID)
+			if d.Attempts != tt.attempts || int(calls.Load()) != tt.attempts {
+				t.Errorf("made %d attempts (logged %d), want %d", calls.Load(), d.Attempts, tt.attempts)
+			}
+			if d.Delivered != tt.delivered {
+				t.Errorf("Delivered = %v, want %v", d.Delivered, tt.delivered)
+			}
+		})
+	}
+}
+
+func TestDeliverWebhookNetworkError(t *testing.T) {
+	defer func(backoff time.Duration) { webhookRetryBackoff = backoff }(webhookRetryBackoff)
+	webhookRetryBackoff = time.Millisecond
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	target := srv.URL
+	srv.Close()
+
+	deliverWebhook("guild-unreachable", target, webhookPayload{ID: "abc", Event: eventTicketClosed}, []byte(`{}`), "s3cret")
+	d := lastDelivery(t, "guild-unreachable")
+	if d.Delivered || d.Attempts != maxWebhookAttempts || d.Error == "" {
+		t.Errorf("delivery = %+v, want %d failed attempts with an error", d, maxWebhookAttempts)
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+// Custom IDs for the components on the setup wizard message.
+const (
+	wizardCategorySelectID = "wizard-category"
+	wizardLogSelectID      = "wizard-log-channel"
+	wizardRoleSelectID     = "wizard-staff-role"
+	wizardCreateButtonID   = "wizard-create"
+	wizardSaveButtonID     = "wizard-save"
+	wizardCancelButtonID   = "wizard-cancel"
+)
+
+// Interaction tokens stop working after 15 minutes, so older wizards can't be answered anyway.
+const wizardTimeout = 15 * time.Minute
+
+// setupWizard holds the choices an admin has made so far in /modmail-setup wizard.
+type setupWizard struct {
+	categoryID   string
+	logChannelID string
+	staffRoleID  string
+	started      time.Time
+}
+
+// Wizards keyed by guild ID + user ID, so two admins can run the wizard at the same time.
+var (
+	setupWizards   = make(map[string]*setupWizard)
+	setupWizardsMu sync.Mutex
+)
+
+func wizardKey(guildID, userID string) string {
+	return guildID + ":" + userID
+}
+
+// handleSetupWizardCommand starts a wizard pre-filled with the guild's current settings.
+func handleSetupWizardCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	wizard := &setupWizard{started: time.Now()}
+	if gc := cfg.guild(i.GuildID); gc != nil {
+		wizard.categoryID = gc.ModMailCategoryID
+		wizard.logChannelID = gc.LogChannelID
+		wizard.staffRoleID = gc.StaffRoleID
+	}
+
+	setupWizardsMu.Lock()
+	for key, w := range setupWizards {
+		if time.Since(w.started) > wizardTimeout {
+			delete(setupWizards, key)
+		}
+	}
+	setupWizards[wizardKey(i.GuildID, i.Member.User.ID)] = wizard
+	embed, components := wizard.render("")
+	setupWizardsMu.Unlock()
+
+	respond(s, i, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
+			Flags:      discordgo.MessageFlagsEphemeral,
+		},
+	})
+}
+
+// render builds the wizard message. note is an optional status line shown under the picks.
+// Callers must hold setupWizardsMu.
+func (w *setupWizard) render(note string) (*discordgo.MessageEmbed, []discordgo.MessageComponent) {
+	show := func(id, format string) string {
+		if id == "" {
+			return "*not set — pick one below or use Create Missing*"
+		}
+		return fmt.Sprintf(format, id)
+	}
+
+	description := "Pick existing resources below, or press **Create Missing** to have the bot create anything you leave empty with the right permissions. Press **Save** when you're done."
+	if note != "" {
+		description += "\n\n" + note
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       "🧙 ModMail Setup Wizard",
+		Description: description,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Ticket Category", Value: show(w.categoryID, "<#%s>")},
+			{Name: "Log Channel", Value: show(w.logChannelID, "<#%s>")},
+			{Name: "Staff Role", Value: show(w.staffRoleID, "<@&%s>")},
+		},
+		Color: 0x00BFFF, // Deep Sky Blue
+	}
+
+	defaults := func(id string, kind discordgo.SelectMenuDefaultValueType) []discordgo.SelectMenuDefaultValue {
+		if id == "" {
+			return nil
+		}
+		return []discordgo.SelectMenuDefaultValue{{ID: id, Type: kind}}
+	}
+	one := 1
+
+	components := []discordgo.MessageComponent{
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.SelectMenu{
+				MenuType:      discordgo.ChannelSelectMenu,
+				CustomID:      wizardCategorySelectID,
+				Placeholder:   "Ticket category",
+				MinValues:     &one,
+				MaxValues:     1,
+				ChannelTypes:  []discordgo.ChannelType{discordgo.ChannelTypeGuildCategory},
+				DefaultValues: defaults(w.categoryID, discordgo.SelectMenuDefaultValueChannel),
+			},
+		}},
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.SelectMenu{
+				MenuType:      discordgo.ChannelSelectMenu,
+				CustomID:      wizardLogSelectID,
+				Placeholder:   "Log channel",
+				MinValues:     &one,
+				MaxValues:     1,
+				ChannelTypes:  []discordgo.ChannelType{discordgo.ChannelTypeGuildText},
+				DefaultValues: defaults(w.logChannelID, discordgo.SelectMenuDefaultValueChannel),
+			},
+		}},
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.SelectMenu{
+				MenuType:      discordgo.RoleSelectMenu,
+				CustomID:      wizardRoleSelectID,
+				Placeholder:   "Staff role",
+				MinValues:     &one,
+				MaxValues:     1,
+				DefaultValues: defaults(w.staffRoleID, discordgo.SelectMenuDefaultValueRole),
+			},
+		}},
+		discordgo.ActionsRow{Components: []discordgo.MessageComponent{
+			discordgo.Button{
+				Label:    "Create Missing",
+				Style:    discordgo.PrimaryButton,
+				CustomID: wizardCreateButtonID,
+				Disabled: w.categoryID != "" && w.logChannelID != "" && w.staffRoleID != "",
+			},
+			discordgo.Button{
+				Label:    "Save",
+				Style:    discordgo.SuccessButton,
+				CustomID: wizardSaveButtonID,
+				Disabled: w.categoryID == "" || w.logChannelID == "" || w.staffRoleID == "",
+			},
+			discordgo.Button{
+				Label:    "Cancel",
+				Style:    discordgo.SecondaryButton,
+				CustomID: wizardCancelButtonID,
+			},
+		}},
+	}
+	return embed, components
+}
+
+// handleWizardComponent handles every select menu and button on the wizard message.
+func handleWizardComponent(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	if i.Member == nil {
+		return
+	}
+	key := wizardKey(i.GuildID, i.Member.User.ID)
+	data := i.MessageComponentData()
+
+	setupWizardsMu.Lock()
+	wizard, ok := setupWizards[key]
+	setupWizardsMu.Unlock()
+	if !ok {
+		updateWizardMessage(s, i, &discordgo.MessageEmbed{
+			Title:       "⌛ Setup Wizard Expired",
+			Description: "Run `/modmail-setup wizard` again to continue.",
+			Color:       0x808080, // Grey
+		}, []discordgo.MessageComponent{})
+		return
+	}
+
+	switch data.CustomID {
+	case wizardCategorySelectID, wizardLogSelectID, wizardRoleSelectID:
+		if len(data.Values) == 0 {
+			return
+		}
+		setupWizardsMu.Lock()
+		switch data.CustomID {
+		case wizardCategorySelectID:
+			wizard.categoryID = data.Values[0]
+		case wizardLogSelectID:
+			wizard.logChannelID = data.Values[0]
+		case wizardRoleSelectID:
+			wizard.staffRoleID = data.Values[0]
+		}
+		embed, components := wizard.render("")
+		setupWizardsMu.Unlock()
+		updateWizardMessage(s, i, embed, components)
+
+	case wizardCreateButtonID:
+		// Creating resources takes several API calls; acknowledge first, then edit the message.
+		respond(s, i, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseDeferredMessageUpdate,
+		})
+		note := createMissingResources(s, i.GuildID, i.Member.User, wizard)
+		setupWizardsMu.Lock()
+		embed, components := wizard.render(note)
+		setupWizardsMu.Unlock()
+		if _, err := s.InteractionResponseEdit(i.Interaction, &discordgo.WebhookEdit{
+			Embeds:     &[]*discordgo.MessageEmbed{embed},
+			Components: &components,
+		}); err != nil {
+			interactionLog(i).Error("Error updating setup wizard", "err", err)
+		}
+
+	case wizardSaveButtonID:
+		setupWizardsMu.Lock()
+		delete(setupWizards, key)
+		setupWizardsMu.Unlock()
+
+		before, _, _ := cfg.updateGuild(i.GuildID, func(gc *GuildConfig) error {
+			gc.ModMailCategoryID = wizard.categoryID
+			gc.LogChannelID = wizard.logChannelID
+			gc.StaffRoleID = wizard.staffRoleID
+			return nil
+		})
+		saveGuildConfig(s, i.GuildID, before, i.Member.User, "/modmail-setup wizard")
+
+		updateWizardMessage(s, i, &discordgo.MessageEmbed{
+			Title: "✅ ModMail Configuration Saved",
+			Description: fmt.Sprintf("* Category: <#%s>\n* Log Channel: <#%s>\n* Staff Role: <@&%s>\n\nRun `/modmail-setup check` to verify everything works.%s",
+				wizard.categoryID, wizard.logChannelID, wizard.staffRoleID, pinnedNote(i.GuildID, "ModMailCategoryID", "LogChannelID", "StaffRoleID")),
+			Color: 0x00FF00, // Green
+		}, []discordgo.MessageComponent{})
+
+	case wizardCancelButtonID:
+		setupWizardsMu.Lock()
+		delete(setupWizards, key)
+		setupWizardsMu.Unlock()
+		updateWizardMessage(s, i, &discordgo.MessageEmbed{
+			Title:       "❎ Setup Wizard Cancelled",
+			Description: "No changes were saved.",
+			Color:       0x808080, // Grey
+		}, []discordgo.MessageComponent{})
+	}
+}
+
+// createMissingResources creates whatever the wizard has no pick for yet: a staff role, a
+// ModMail category only staff can see, and a private log channel. It returns a status line
+// for the wizard message. Whatever was created is recorded in the audit log, even if a later
+// step fails.
+func createMissingResources(s *discordgo.Session, guildID string, actor *discordgo.User, w *setupWizard) string {
+	setupWizardsMu.Lock()
+	categoryID, logChannelID, staffRoleID := w.categoryID, w.logChannelID, w.staffRoleID
+	setupWizardsMu.Unlock()
+
+	// Record each resource as soon as it exists, so a later failure doesn't orphan it.
+	var created, audited []string
+	ids := make(map[string]string)
+	var overwrites []*discordgo.PermissionOverwrite
+	record := func(what, kind, mention string, field *string, id string) {
+		setupWizardsMu.Lock()
+		*field = id
+		setupWizardsMu.Unlock()
+		created = append(created, what)
+		audited = append(audited, what+" "+mention)
+		ids[kind] = id
+	}
+	defer func() {
+		if len(ids) == 0 {
+			return
+		}
+		if ids["category"] == "" && ids["log_channel"] == "" {
+			overwrites = nil // No channel was created with them
+		}
+		auditCreated(s, guildID, actor, "/modmail-setup wizard", audited, ids, overwrites)
+	}()
+	failed := func(what string, err error) string {
+		slog.Error("Error creating setup resource", "guild_id", guildID, "resource", what, "err", err)
+		note := fmt.Sprintf("❌ Couldn't create the %s: make sure the bot has Manage Roles and Manage Channels.", what)
+		if len(created) > 0 {
+			note += " Created so far: " + strings.Join(created, ", ") + "."
+		}
+		return note
+	}
+
+	if staffRoleID == "" {
+		mentionable := true
+		role, err := s.GuildRoleCreate(guildID, &discordgo.RoleParams{Name: "ModMail Staff", Mentionable: &mentionable})
+		if err != nil {
+			return failed("staff role", err)
+		}
+		staffRoleID = role.ID
+		record("staff role", "staff_role", "<@&"+role.ID+">", &w.staffRoleID, role.ID)
+	}
+
+	// Only staff and the bot can see ModMail channels.
+	overwrites = []*discordgo.PermissionOverwrite{
+		{
+			ID:   guildID, // @everyone role
+			Type: discordgo.PermissionOverwriteTypeRole,
+			Deny: discordgo.PermissionViewChannel,
+		},
+		{
+			ID:   staffRoleID,
+			Type: discordgo.PermissionOverwriteTypeRole,
+			Allow: discordgo.PermissionViewChannel |
+				discordgo.PermissionSendMessages |
+				discordgo.PermissionReadMessageHistory,
+		},
+		{
+			ID:   s.State.User.ID,
+			Type: discordgo.PermissionOverwriteTypeMember,
+			Allow: discordgo.PermissionViewChannel |
+				discordgo.PermissionSendMessages |
+				discordgo.PermissionEmbedLinks |
+				discordgo.PermissionAttachFiles |
+				discordgo.PermissionReadMessageHistory |
+				discordgo.PermissionManageChannels |
+				discordgo.PermissionManageRoles,
+		},
+	}
+
+	if categoryID == "" {
+		category, err := s.GuildChannelCreateComplex(guildID, discordgo.GuildChannelCreateData{
+			Name:                 "ModMail",
+			Type:                 discordgo.ChannelTypeGuildCategory,
+			PermissionOverwrites: overwrites,
+		})
+		if err != nil {
+			return failed("ticket category", err)
+		}
+		record("ticket category", "category", "<#"+category.ID+">", &w.categoryID, category.ID)
+	}
+
+	if logChannelID == "" {
+		// Kept outside the ticket category so it is never mistaken for a ticket channel.
+		logChannel, err := s.GuildChannelCreateComplex(guildID, discordgo.GuildChannelCreateData{
+			Name:                 "modmail-logs",
+			Type:                 discordgo.ChannelTypeGuildText,
+			Topic:                "ModMail transcripts and ticket logs",
+			PermissionOverwrites: overwrites,
+		})
+		if err != nil {
+			return failed("log channel", err)
+		}
+		record("log channel", "log_channel", "<#"+logChannel.ID+">", &w.logChannelID, logChannel.ID)
+	}
+
+	if len(created) == 0 {
+		return "Nothing to create."
+	}
+	return "✅ Created: " + strings.Join(created, ", ") + ". Remember to give the staff role to your team, then press **Save**."
+}
+
+func updateWizardMessage(s *discordgo.Session, i *discordgo.InteractionCreate, embed *discordgo.MessageEmbed, components []discordgo.MessageComponent) {
+	err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     []*discordgo.MessageEmbed{embed},
+			Components: components,
+		},
+	})
+	if err != nil {
+		interactionLog(i).Error("Error updating setup wizard", "err", err)
+	}
+}